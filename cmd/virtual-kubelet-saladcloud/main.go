@@ -5,10 +5,13 @@
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/provider"
@@ -23,6 +26,10 @@
 	"github.com/virtual-kubelet/virtual-kubelet/node"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
@@ -35,6 +42,9 @@
 		"NoExecute":        v1.TaintEffectNoExecute,
 		"PreferNoSchedule": v1.TaintEffectPreferNoSchedule,
 	}
+	eventBroadcaster record.EventBroadcaster
+	eventRecorder    record.EventRecorder
+	kubeClient       kubernetes.Interface
 )
 
 func defaultInputs() models.InputVars {
@@ -53,15 +63,30 @@ func defaultInputs() models.InputVars {
 	}
 
 	return models.InputVars{
-		NodeName:         "saladcloud-node",
-		KubeConfig:       kubeConfig,
-		LogLevel:         "info",
-		OrganizationName: "",
-		TaintKey:         "virtual-kubelet.io/provider",
-		TaintEffect:      "NoSchedule",
-		TaintValue:       "saladcloud",
-		ProjectName:      "",
-		ApiKey:           "",
+		NodeName:                   "saladcloud-node",
+		KubeConfig:                 kubeConfig,
+		LogLevel:                   "info",
+		OrganizationName:           "",
+		TaintKey:                   "virtual-kubelet.io/provider",
+		TaintEffect:                "NoSchedule",
+		TaintValue:                 "saladcloud",
+		ProjectName:                "",
+		ApiKey:                     "",
+		MultiContainerPolicy:       provider.MultiContainerPolicyReject,
+		APIRateLimit:               10,
+		APIRateBurst:               20,
+		APIMaxRetries:              3,
+		APICircuitBreakerThreshold: 5,
+		APICircuitBreakerCooldown:  30 * time.Second,
+		APIReadTimeout:             30 * time.Second,
+		APIWriteTimeout:            time.Minute,
+		NodeCPU:                    provider.DefaultNodeCPU,
+		NodeMemory:                 provider.DefaultNodeMemory,
+		NodePods:                   provider.DefaultNodePods,
+		NodeStorage:                provider.DefaultNodeStorage,
+		QuotaRefreshInterval:       5 * time.Minute,
+		GPUResourceName:            provider.DefaultGPUResourceName,
+		MetricsPort:                9464,
 	}
 }
 
@@ -86,6 +111,28 @@ func initCommandFlags() {
 	virtualKubeletCommand.Flags().StringVar(&inputs.ApiKey, "sce-api-key", inputs.ApiKey, "SaladCloud API Key")
 	virtualKubeletCommand.Flags().StringVar(&inputs.OrganizationName, "sce-organization-name", inputs.OrganizationName, "SaladCloud Organization Name")
 	virtualKubeletCommand.Flags().StringVar(&inputs.ProjectName, "sce-project-name", inputs.ProjectName, "SaladCloud Project Name")
+	virtualKubeletCommand.Flags().StringVar(&inputs.ClusterID, "cluster-id", inputs.ClusterID, "Cluster identifier used to tag the container groups owned by this node")
+	virtualKubeletCommand.Flags().StringVar(&inputs.MultiContainerPolicy, "multi-container-policy", inputs.MultiContainerPolicy, "How to handle pods with more than one container: reject or ignore-sidecars")
+	virtualKubeletCommand.Flags().Float64Var(&inputs.APIRateLimit, "api-rate-limit", inputs.APIRateLimit, "Maximum SaladCloud API requests per second, 0 disables the limit")
+	virtualKubeletCommand.Flags().IntVar(&inputs.APIRateBurst, "api-rate-burst", inputs.APIRateBurst, "Maximum burst of SaladCloud API requests")
+	virtualKubeletCommand.Flags().IntVar(&inputs.APIMaxRetries, "api-max-retries", inputs.APIMaxRetries, "Retries of failed SaladCloud API calls")
+	virtualKubeletCommand.Flags().IntVar(&inputs.APICircuitBreakerThreshold, "api-circuit-breaker-threshold", inputs.APICircuitBreakerThreshold, "Consecutive failed SaladCloud API calls that mark the node NotReady, 0 disables the circuit breaker")
+	virtualKubeletCommand.Flags().DurationVar(&inputs.APICircuitBreakerCooldown, "api-circuit-breaker-cooldown", inputs.APICircuitBreakerCooldown, "Time to wait before probing the SaladCloud API again once the circuit breaker is open")
+	virtualKubeletCommand.Flags().DurationVar(&inputs.APIReadTimeout, "api-read-timeout", inputs.APIReadTimeout, "Deadline of SaladCloud API calls that read container groups and logs, retries included")
+	virtualKubeletCommand.Flags().DurationVar(&inputs.APIWriteTimeout, "api-write-timeout", inputs.APIWriteTimeout, "Deadline of SaladCloud API calls that create, update or delete container groups, retries included")
+	virtualKubeletCommand.Flags().StringVar(&inputs.NodeCPU, "node-cpu", inputs.NodeCPU, "CPU capacity of the node")
+	virtualKubeletCommand.Flags().StringVar(&inputs.NodeMemory, "node-memory", inputs.NodeMemory, "Memory capacity of the node")
+	virtualKubeletCommand.Flags().StringVar(&inputs.NodePods, "node-pods", inputs.NodePods, "Pods capacity of the node")
+	virtualKubeletCommand.Flags().StringVar(&inputs.NodeStorage, "node-storage", inputs.NodeStorage, "Storage capacity of the node")
+	virtualKubeletCommand.Flags().BoolVar(&inputs.CapacityFromQuotas, "capacity-from-quotas", inputs.CapacityFromQuotas, "Take the pods capacity of the node from the container replicas quota of the SaladCloud organization")
+	virtualKubeletCommand.Flags().DurationVar(&inputs.QuotaRefreshInterval, "quota-refresh-interval", inputs.QuotaRefreshInterval, "Interval between refreshes of the node capacity from the SaladCloud quotas")
+	virtualKubeletCommand.Flags().StringVar(&inputs.GPUResourceName, "gpu-resource-name", inputs.GPUResourceName, "Extended resource of GPU pods that may run on any GPU class, empty disables GPU resources")
+	virtualKubeletCommand.Flags().StringToStringVar(&inputs.GPUClassResources, "gpu-class-resources", inputs.GPUClassResources, "GPU class of every salad.com/gpu-<suffix> extended resource as suffix=class name or ID, all GPU classes of the organization when empty")
+	virtualKubeletCommand.Flags().BoolVar(&inputs.AccessDomainServices, "access-domain-services", inputs.AccessDomainServices, "Create ExternalName Services to the access domain names of pods labeled salad.com/expose-service")
+	virtualKubeletCommand.Flags().BoolVar(&inputs.ReplicaSetContainerGroups, "replica-set-container-groups", inputs.ReplicaSetContainerGroups, "Run the pods of a ReplicaSet as the instances of a single container group whose replicas follow the ReplicaSet")
+	virtualKubeletCommand.Flags().IntVar(&inputs.MetricsPort, "metrics-port", inputs.MetricsPort, "Port of the /metrics endpoint of the provider, 0 disables it")
+	virtualKubeletCommand.Flags().BoolVar(&inputs.StalePodCleanupDryRun, "stale-pod-cleanup-dry-run", inputs.StalePodCleanupDryRun, "Only report stale container groups instead of deleting them")
+	virtualKubeletCommand.Flags().DurationVar(&inputs.FinishedContainerGroupTTL, "finished-container-group-ttl", inputs.FinishedContainerGroupTTL, "How long the container groups of succeeded and failed pods are kept, 0 keeps them until the pods are deleted")
 }
 
 func runNode(ctx context.Context) error {
@@ -94,11 +141,16 @@ func runNode(ctx context.Context) error {
 
 	node, err := nodeutil.NewNode(inputs.NodeName, func(config nodeutil.ProviderConfig) (nodeutil.Provider, node.NodeProvider, error) {
 		return newSaladCloudProvider(ctx, config)
-	}, withClient, withTaint)
+	}, withClient, withEventRecorder, withTaint)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create new node")
 		return err
 	}
+	defer eventBroadcaster.Shutdown()
+
+	if inputs.MetricsPort != 0 {
+		go serveMetrics(ctx)
+	}
 
 	go func() {
 		if err := node.Run(ctx); err != nil {
@@ -119,14 +171,36 @@ func runNode(ctx context.Context) error {
 	return nil
 }
 
+// serveMetrics serves the provider metrics until the context is done
+func serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", provider.MetricsHandler())
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", inputs.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logrus.Infof("Serving metrics on %s/metrics", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logrus.WithError(err).Error("Metrics server error")
+	}
+}
+
 func newSaladCloudProvider(ctx context.Context, pc nodeutil.ProviderConfig) (nodeutil.Provider, node.NodeProvider, error) {
-	p, err := provider.NewSaladCloudProvider(ctx, inputs, pc)
+	p, err := provider.NewSaladCloudProvider(ctx, inputs, pc, eventRecorder, kubeClient)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create SaladCloud provider")
 		return nil, nil, err
 	}
-	p.ConfigureNode(context.Background(), pc.Node)
-	return p, nil, nil
+	p.ConfigureNode(ctx, pc.Node)
+	return p, p.NewNodeProvider(pc.Node), nil
 }
 
 func withTaint(cfg *nodeutil.NodeConfig) error {
@@ -157,6 +231,17 @@ func withClient(cfg *nodeutil.NodeConfig) error {
 		return err
 	}
 	cfg.Client = client
+	kubeClient = client
+	return nil
+}
+
+// withEventRecorder shares one event recorder between the pod controller and the provider
+func withEventRecorder(cfg *nodeutil.NodeConfig) error {
+	eventBroadcaster = record.NewBroadcaster()
+	eventBroadcaster.StartLogging(logrus.Infof)
+	eventBroadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: cfg.Client.CoreV1().Events(v1.NamespaceAll)})
+	eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: path.Join(inputs.NodeName, "pod-controller")})
+	cfg.EventRecorder = eventRecorder
 	return nil
 }
 
@@ -190,6 +275,8 @@ func randSeq(n int) string {
 				envName = "CLOUD_ORGANIZATION_NAME"
 			case "sce-project-name":
 				envName = "CLOUD_PROJECT_NAME"
+			case "cluster-id":
+				envName = "VK_CLUSTER_ID"
 			}
 
 			if envName != "" && !f.Changed && v.IsSet(envName) {
@@ -209,6 +296,10 @@ func randSeq(n int) string {
 			logrus.Fatal("A SaladCloud project name is required")
 		}
 
+		if inputs.MultiContainerPolicy != provider.MultiContainerPolicyReject && inputs.MultiContainerPolicy != provider.MultiContainerPolicyIgnoreSidecars {
+			logrus.Fatalf("Unsupported multi-container policy %q", inputs.MultiContainerPolicy)
+		}
+
 		if !cmd.Flags().Changed("nodename") {
 			inputs.NodeName = fmt.Sprintf("%s-%s", inputs.NodeName, randSeq(3))
 		}
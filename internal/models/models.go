@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type InputVars struct {
 	NodeName         string
 	KubeConfig       string
@@ -11,6 +13,42 @@ type InputVars struct {
 	OrganizationName string
 	ProjectName      string
 	ApiKey           string
+	ClusterID        string
+	// Only report stale container groups instead of deleting them
+	StalePodCleanupDryRun bool
+	// How to handle pods with more than one container, see provider.MultiContainerPolicyReject
+	MultiContainerPolicy string
+	// SaladCloud API requests per second, zero disables the limit
+	APIRateLimit float64
+	APIRateBurst int
+	// Retries of failed SaladCloud API calls
+	APIMaxRetries int
+	// Consecutive failed SaladCloud API calls that open the circuit breaker, zero disables it
+	APICircuitBreakerThreshold int
+	APICircuitBreakerCooldown  time.Duration
+	// Deadlines of SaladCloud API calls that read and that change container groups, retries included
+	APIReadTimeout  time.Duration
+	APIWriteTimeout time.Duration
+	// Node capacity, the defaults of the provider are used when empty
+	NodeCPU     string
+	NodeMemory  string
+	NodePods    string
+	NodeStorage string
+	// Take the pods capacity from the container replicas quota of the organization
+	CapacityFromQuotas   bool
+	QuotaRefreshInterval time.Duration
+	// Extended resource of GPU pods that may run on any GPU class, empty disables GPU resources
+	GPUResourceName string
+	// Extended resource suffixes of single GPU classes, such as rtx4090, mapped to class names or IDs
+	GPUClassResources map[string]string
+	// Create ExternalName Services to the access domain names of pods labeled salad.com/expose-service
+	AccessDomainServices bool
+	// Port of the provider metrics endpoint, zero disables it
+	MetricsPort int
+	// Run the pods of a ReplicaSet as the instances of a single container group
+	ReplicaSetContainerGroups bool
+	// How long the container groups of finished pods are kept, zero keeps them until the pods are deleted
+	FinishedContainerGroupTTL time.Duration
 }
 
 type CreateContainerGroupModel struct {
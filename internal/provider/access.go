@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Annotation set on pods to the access domain name of their container group gateway
+	accessDomainAnnotation = "salad.com/access-domain-name"
+	// Pods with this label get an ExternalName Service to their access domain name, named after
+	// the label value or after the pod when the value is "true"
+	exposeServiceLabel = "salad.com/expose-service"
+	// Label of the Services managed by the provider
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "virtual-kubelet-saladcloud"
+
+	podConditionAccessDomain corev1.PodConditionType = "salad.com/AccessDomainReady"
+)
+
+// getAccessDomainName returns the domain name SaladCloud assigned to the container gateway, if any
+func getAccessDomainName(containerGroup *saladclient.ContainerGroup) string {
+	if containerGroup.Networking == nil {
+		return ""
+	}
+	return containerGroup.Networking.Dns
+}
+
+// getAccessDomainCondition reports the access domain name on the pod status
+func getAccessDomainCondition(containerGroup *saladclient.ContainerGroup) (corev1.PodCondition, bool) {
+	dns := getAccessDomainName(containerGroup)
+	if dns == "" {
+		return corev1.PodCondition{}, false
+	}
+	return corev1.PodCondition{
+		Type:    podConditionAccessDomain,
+		Status:  corev1.ConditionTrue,
+		Reason:  "AccessDomainAssigned",
+		Message: dns,
+	}, true
+}
+
+// publishAccessDomain writes the access domain name of the container group to the pod annotation
+// and, when enabled, to the ExternalName Service of the pod
+func (p *SaladCloudProvider) publishAccessDomain(ctx context.Context, namespace, name string, containerGroup *saladclient.ContainerGroup) {
+	dns := getAccessDomainName(containerGroup)
+	if dns == "" || p.kubeClient == nil || p.podLister == nil {
+		return
+	}
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return
+	}
+
+	if pod.Annotations[accessDomainAnnotation] != dns {
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{accessDomainAnnotation: dns},
+			},
+		})
+		if _, err := p.kubeClient.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			p.logger.WithError(err).Errorf("publishAccessDomain: failed to annotate pod %s/%s", namespace, name)
+		}
+	}
+
+	if serviceName := getExposedServiceName(pod); p.inputVars.AccessDomainServices && serviceName != "" {
+		p.ensureAccessDomainService(ctx, pod, serviceName, dns)
+	}
+}
+
+func getExposedServiceName(pod *corev1.Pod) string {
+	switch value := pod.Labels[exposeServiceLabel]; value {
+	case "", "false":
+		return ""
+	case "true":
+		return pod.Name
+	default:
+		return value
+	}
+}
+
+// ensureAccessDomainService creates or updates the ExternalName Service of the pod. The Service is
+// owned by the pod, so that it is garbage collected with it. Services not managed by the provider
+// are left alone.
+func (p *SaladCloudProvider) ensureAccessDomainService(ctx context.Context, pod *corev1.Pod, serviceName, dns string) {
+	services := p.kubeClient.CoreV1().Services(pod.Namespace)
+	var existing *corev1.Service
+	var err error
+	if p.serviceLister != nil {
+		existing, err = p.serviceLister.Services(pod.Namespace).Get(serviceName)
+	} else {
+		existing, err = services.Get(ctx, serviceName, metav1.GetOptions{})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		p.logger.WithError(err).Errorf("ensureAccessDomainService: failed to get service %s/%s", pod.Namespace, serviceName)
+		return
+	}
+
+	ownerReferences := []metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: pod.Name, UID: pod.UID}}
+	if apierrors.IsNotFound(err) {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            serviceName,
+				Namespace:       pod.Namespace,
+				Labels:          map[string]string{managedByLabel: managedByValue},
+				OwnerReferences: ownerReferences,
+			},
+			Spec: corev1.ServiceSpec{
+				Type:         corev1.ServiceTypeExternalName,
+				ExternalName: dns,
+			},
+		}
+		if _, err := services.Create(ctx, service, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			p.logger.WithError(err).Errorf("ensureAccessDomainService: failed to create service %s/%s", pod.Namespace, serviceName)
+			return
+		}
+		p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonAccessDomainServiceCreated, "Created service %s for access domain %s", serviceName, dns)
+		return
+	}
+
+	if existing.Labels[managedByLabel] != managedByValue {
+		p.logger.Warnf("ensureAccessDomainService: service %s/%s is not managed by the provider, leaving it alone", pod.Namespace, serviceName)
+		return
+	}
+	ownedByPod := len(existing.OwnerReferences) == 1 && existing.OwnerReferences[0].UID == pod.UID
+	if ownedByPod && existing.Spec.Type == corev1.ServiceTypeExternalName && existing.Spec.ExternalName == dns {
+		return
+	}
+	if !ownedByPod && len(existing.OwnerReferences) > 0 && p.isPodAlive(pod.Namespace, existing.OwnerReferences[0]) {
+		// Pods sharing a service name leave it to the first one, until it is replaced
+		return
+	}
+	service := existing.DeepCopy()
+	service.OwnerReferences = ownerReferences
+	service.Spec.Type = corev1.ServiceTypeExternalName
+	service.Spec.ExternalName = dns
+	if _, err := services.Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		p.logger.WithError(err).Errorf("ensureAccessDomainService: failed to update service %s/%s", pod.Namespace, serviceName)
+	}
+}
+
+func (p *SaladCloudProvider) isPodAlive(namespace string, owner metav1.OwnerReference) bool {
+	pod, err := p.podLister.Pods(namespace).Get(owner.Name)
+	return err == nil && pod.UID == owner.UID
+}
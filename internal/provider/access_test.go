@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_publishAccessDomain(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "web",
+		UID:       "uid",
+		Labels:    map[string]string{exposeServiceLabel: "true"},
+	}}
+	client := fake.NewSimpleClientset(pod)
+	p, _ := newProvider()
+	p.kubeClient = client
+	p.podLister = newTestPodLister(pod)
+	p.inputVars.AccessDomainServices = true
+
+	containerGroup := newTestContainerGroup("default-web", "nginx")
+	networking := saladclient.NewContainerGroupNetworking(false, "web-1a2b.salad.cloud", saladclient.CONTAINERGROUPNETWORKINGLOADBALANCER_ROUND_ROBIN, 80, saladclient.CONTAINERNETWORKINGPROTOCOL_HTTP)
+	containerGroup.Networking = networking
+
+	p.publishAccessDomain(context.Background(), "default", "web", &containerGroup)
+
+	updated, err := client.CoreV1().Pods("default").Get(context.Background(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "web-1a2b.salad.cloud", updated.Annotations[accessDomainAnnotation])
+
+	service, err := client.CoreV1().Services("default").Get(context.Background(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ServiceTypeExternalName, service.Spec.Type)
+	assert.Equal(t, "web-1a2b.salad.cloud", service.Spec.ExternalName)
+	assert.Equal(t, pod.UID, service.OwnerReferences[0].UID)
+
+	// The service follows the access domain name
+	networking.Dns = "web-3c4d.salad.cloud"
+	p.publishAccessDomain(context.Background(), "default", "web", &containerGroup)
+	service, err = client.CoreV1().Services("default").Get(context.Background(), "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "web-3c4d.salad.cloud", service.Spec.ExternalName)
+
+	status := p.podStatusFromContainerGroup("default", "web", &containerGroup)
+	assert.Contains(t, status.Conditions, corev1.PodCondition{
+		Type: podConditionAccessDomain, Status: corev1.ConditionTrue, Reason: "AccessDomainAssigned", Message: "web-3c4d.salad.cloud",
+	})
+}
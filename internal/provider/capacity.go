@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getNodeResources returns the capacity and allocatable resources of the node
+func (p *SaladCloudProvider) getNodeResources(ctx context.Context) (corev1.ResourceList, corev1.ResourceList) {
+	capacity := p.getNodeCapacity()
+	allocatable := capacity.DeepCopy()
+	if p.inputVars.CapacityFromQuotas {
+		p.setPodsFromQuotas(ctx, capacity, allocatable)
+	}
+	p.addGPUResources(ctx, capacity, allocatable)
+	return capacity, allocatable
+}
+
+// setPodsFromQuotas fits the pods of the node to the container replicas quota of the organization,
+// less the replicas used by workloads that are not pods of this node. The scheduler accounts for
+// the pods of the node itself.
+func (p *SaladCloudProvider) setPodsFromQuotas(ctx context.Context, capacity, allocatable corev1.ResourceList) {
+	quotas, err := p.getContainerGroupsQuotas(ctx)
+	if err != nil {
+		p.logger.WithError(err).Warnf("getNodeResources: failed to get quotas, using the configured capacity")
+		return
+	}
+	containerGroups, err := p.listContainerGroups(ctx)
+	if err != nil {
+		p.logger.WithError(err).Warnf("getNodeResources: failed to list container groups, using the configured capacity")
+		return
+	}
+
+	var ownReplicas int32
+	for _, containerGroup := range containerGroups {
+		if p.isNodePodContainerGroup(containerGroup) {
+			ownReplicas += containerGroup.Replicas
+		}
+	}
+	otherReplicas := max(quotas.ContainerReplicasUsed-ownReplicas, 0)
+	capacity[corev1.ResourcePods] = *resource.NewQuantity(int64(quotas.ContainerReplicasQuota), resource.DecimalSI)
+	allocatable[corev1.ResourcePods] = *resource.NewQuantity(int64(max(quotas.ContainerReplicasQuota-otherReplicas, 0)), resource.DecimalSI)
+}
+
+// isNodePodContainerGroup reports whether the container group runs a pod scheduled on this node
+func (p *SaladCloudProvider) isNodePodContainerGroup(containerGroup saladclient.ContainerGroup) bool {
+	if p.podLister == nil {
+		return false
+	}
+	env := containerGroup.Container.EnvironmentVariables
+	if uid, ok := getContainerGroupReplicaSetUID(containerGroup); ok {
+		pods, err := p.getReplicaSetPods(env[ownerPodNamespaceEnvVar], &metav1.OwnerReference{UID: types.UID(uid)})
+		return err == nil && len(pods) > 0
+	}
+	if _, ok := getContainerGroupPodKey(containerGroup); !ok {
+		return false
+	}
+	_, err := p.podLister.Pods(env[ownerPodNamespaceEnvVar]).Get(env[ownerPodNameEnvVar])
+	return err == nil
+}
+
+func (p *SaladCloudProvider) getContainerGroupsQuotas(ctx context.Context) (*saladclient.ContainerGroupsQuotas, error) {
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	resp, r, err := p.apiClient.QuotasAPI.GetQuotas(getCtx, p.inputVars.OrganizationName).Execute()
+	if err != nil {
+		pd, err := utils.GetResponseBody(r)
+		if err != nil {
+			p.logger.Errorf("getContainerGroupsQuotas: %s", err)
+			return nil, err
+		}
+
+		p.logger.Errorf("`QuotasAPI.GetQuotas`: Error: %+v", *pd)
+		return nil, models.NewSaladCloudError(fmt.Errorf("%s", pd.GetDetail()), r)
+	}
+	return &resp.ContainerGroupsQuotas, nil
+}
+
+// refreshNodeResources updates the node resources from the quotas until the context is done
+func (np *NodeProvider) refreshNodeResources(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			capacity, allocatable := np.provider.getNodeResources(ctx)
+			np.setNodeResources(capacity, allocatable)
+		}
+	}
+}
+
+func (np *NodeProvider) setNodeResources(capacity, allocatable corev1.ResourceList) {
+	np.mu.Lock()
+	changed := !resourceListsEqual(np.node.Status.Capacity, capacity) || !resourceListsEqual(np.node.Status.Allocatable, allocatable)
+	np.node.Status.Capacity = capacity
+	np.node.Status.Allocatable = allocatable
+	np.mu.Unlock()
+	if changed {
+		np.notify()
+	}
+}
+
+func resourceListsEqual(a, b corev1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, quantity := range a {
+		other, ok := b[name]
+		if !ok || quantity.Cmp(other) != 0 {
+			return false
+		}
+	}
+	return true
+}
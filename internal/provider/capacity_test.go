@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_getNodeResources(t *testing.T) {
+	containerGroup := newTestContainerGroup("default-web", "nginx")
+	containerGroup.Replicas = 3
+	containerGroup.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerPodNameEnvVar: "web"}
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/organizations/org/quotas":
+			_ = json.NewEncoder(w).Encode(saladclient.NewQuotas(*saladclient.NewContainerGroupsQuotas(10, 5)))
+		case "/organizations/org/projects/project/containers":
+			_ = json.NewEncoder(w).Encode(saladclient.NewContainerGroupCollection([]saladclient.ContainerGroup{containerGroup}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	p.podLister = newTestPodLister(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}})
+	p.inputVars.NodeCPU = "100"
+	assert.NoError(t, p.setNodeCapacity())
+
+	// The configured capacity is used as is
+	capacity, allocatable := p.getNodeResources(context.Background())
+	assert.Equal(t, resource.MustParse("100"), capacity[corev1.ResourceCPU])
+	assert.Equal(t, resource.MustParse(DefaultNodePods), allocatable[corev1.ResourcePods])
+
+	// Replicas of this node are not taken off the allocatable pods
+	p.inputVars.CapacityFromQuotas = true
+	capacity, allocatable = p.getNodeResources(context.Background())
+	assert.Equal(t, int64(10), capacity.Pods().Value())
+	assert.Equal(t, int64(8), allocatable.Pods().Value())
+	assert.Equal(t, resource.MustParse("100"), allocatable[corev1.ResourceCPU])
+
+	p.inputVars.NodeMemory = "lots"
+	assert.Error(t, p.setNodeCapacity())
+}
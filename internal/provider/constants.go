@@ -11,3 +11,27 @@
 	"KUBERNETES_SERVICE_PORT",
 	"KUBERNETES_SERVICE_PORT_HTTPS",
 }
+
+// Environment variables used to tag container groups created by this provider.
+// SaladCloud container groups have no labels, so ownership travels with the
+// container environment and comes back on every container group read.
+const (
+	ownerNodeNameEnvVar  = "SALAD_VK_NODE_NAME"
+	ownerClusterIDEnvVar = "SALAD_VK_CLUSTER_ID"
+	ownerPodUIDEnvVar    = "SALAD_VK_POD_UID"
+	// Map a container group back to its pod, the name of the container group is not reversible
+	ownerPodNamespaceEnvVar = "SALAD_VK_POD_NAMESPACE"
+	ownerPodNameEnvVar      = "SALAD_VK_POD_NAME"
+	// Container groups shared by the pods of a ReplicaSet carry the ReplicaSet instead of a pod
+	ownerReplicaSetNameEnvVar = "SALAD_VK_REPLICA_SET_NAME"
+	ownerReplicaSetUIDEnvVar  = "SALAD_VK_REPLICA_SET_UID"
+)
+
+// Labels set on pods returned by GetContainerGroupPods to carry the ownership tags of the
+// container group they were built from
+const (
+	ownerNodeNameLabel  = "salad.com/owner-node-name"
+	ownerClusterIDLabel = "salad.com/owner-cluster-id"
+	// UID of the ReplicaSet of container groups shared by its pods
+	ownerReplicaSetLabel = "salad.com/owner-replica-set-uid"
+)
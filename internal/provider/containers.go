@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Policies for pods with more than one container. A SaladCloud container group runs exactly one container.
+const (
+	// Reject every pod with more than one container
+	MultiContainerPolicyReject = "reject"
+	// Drop the containers listed in the salad.com/ignored-containers annotation and run the remaining one
+	MultiContainerPolicyIgnoreSidecars = "ignore-sidecars"
+)
+
+const ignoredContainerReason = "IgnoredBySaladCloud"
+
+// getMainContainer returns the single container of the pod that runs on SaladCloud
+func (p *SaladCloudProvider) getMainContainer(pod *corev1.Pod) (corev1.Container, error) {
+	containers := pod.Spec.Containers
+	if len(containers) == 0 {
+		return corev1.Container{}, fmt.Errorf("pod %s/%s has no containers", pod.Namespace, pod.Name)
+	}
+	if len(containers) == 1 {
+		return containers[0], nil
+	}
+	if p.inputVars.MultiContainerPolicy != MultiContainerPolicyIgnoreSidecars {
+		return corev1.Container{}, fmt.Errorf("pod has %d containers but SaladCloud runs a single container per container group", len(containers))
+	}
+
+	ignored := p.getIgnoredContainers(pod)
+	for name := range ignored {
+		if !hasContainer(pod, name) {
+			return corev1.Container{}, fmt.Errorf("salad.com/ignored-containers lists unknown container %q", name)
+		}
+	}
+	remaining := make([]corev1.Container, 0, 1)
+	for _, container := range containers {
+		if !ignored[container.Name] {
+			remaining = append(remaining, container)
+		}
+	}
+	if len(remaining) != 1 {
+		return corev1.Container{}, fmt.Errorf("pod has %d containers that are not listed in salad.com/ignored-containers, exactly one is required", len(remaining))
+	}
+	return remaining[0], nil
+}
+
+// getIgnoredContainers returns the sidecars that are not run on SaladCloud
+func (p *SaladCloudProvider) getIgnoredContainers(pod *corev1.Pod) map[string]bool {
+	ignored := make(map[string]bool)
+	if p.inputVars.MultiContainerPolicy != MultiContainerPolicyIgnoreSidecars {
+		return ignored
+	}
+	names, ok := pod.Annotations["salad.com/ignored-containers"]
+	if !ok {
+		return ignored
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			ignored[name] = true
+		}
+	}
+	return ignored
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getContainerStatuses reports the main container with the state of the container group and
+// every ignored sidecar as not running
+func (p *SaladCloudProvider) getContainerStatuses(namespace, name string, containerGroup *saladclient.ContainerGroup, ready bool) []corev1.ContainerStatus {
+	mainStatus := corev1.ContainerStatus{
+		Name:  containerGroup.Name,
+		Image: containerGroup.Container.Image,
+		Ready: ready,
+		State: getContainerState(containerGroup.CurrentState),
+	}
+	if p.podLister == nil {
+		return []corev1.ContainerStatus{mainStatus}
+	}
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return []corev1.ContainerStatus{mainStatus}
+	}
+	mainContainer, err := p.getMainContainer(pod)
+	if err != nil {
+		return []corev1.ContainerStatus{mainStatus}
+	}
+	mainStatus.Name = mainContainer.Name
+
+	containerStatuses := make([]corev1.ContainerStatus, 0, len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		if container.Name == mainContainer.Name {
+			containerStatuses = append(containerStatuses, mainStatus)
+		} else {
+			containerStatuses = append(containerStatuses, getIgnoredContainerStatus(container))
+		}
+	}
+	return containerStatuses
+}
+
+// isIgnoredContainerStatus reports whether the status is that of a sidecar that does not run on SaladCloud
+func isIgnoredContainerStatus(containerStatus corev1.ContainerStatus) bool {
+	waiting := containerStatus.State.Waiting
+	return waiting != nil && waiting.Reason == ignoredContainerReason
+}
+
+// areContainersReady reports whether every container running on SaladCloud is ready. Ignored
+// sidecars never run, so they keep neither ContainersReady nor Ready from being true.
+func areContainersReady(containerStatuses []corev1.ContainerStatus) bool {
+	ready := false
+	for _, containerStatus := range containerStatuses {
+		if isIgnoredContainerStatus(containerStatus) {
+			continue
+		}
+		if !containerStatus.Ready {
+			return false
+		}
+		ready = true
+	}
+	return ready
+}
+
+func getIgnoredContainerStatus(container corev1.Container) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  container.Name,
+		Image: container.Image,
+		Ready: false,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{
+				Reason:  ignoredContainerReason,
+				Message: "Container is listed in salad.com/ignored-containers and does not run on SaladCloud",
+			},
+		},
+	}
+}
+
+// markPodFailed moves a pod the provider can never run to a terminal Failed phase
+func (p *SaladCloudProvider) markPodFailed(pod *corev1.Pod, message string) {
+	now := metav1.NewTime(time.Now())
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.Reason = "ProviderFailed"
+	pod.Status.Message = message
+	pod.Status.ContainerStatuses = nil
+	for _, container := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  container.Name,
+			Image: container.Image,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode:   1,
+					Reason:     "ProviderFailed",
+					Message:    message,
+					FinishedAt: now,
+				},
+			},
+		})
+	}
+	if p.podsTracker != nil {
+		p.podsTracker.updateCallback(pod)
+	}
+}
@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Matches downward API paths into a map such as metadata.labels['app']
+var fieldPathSubscriptRegex = regexp.MustCompile(`^(metadata\.labels|metadata\.annotations)\['(.+)'\]$`)
+
+// Downward API fields that differ between the pods sharing the container group of their
+// ReplicaSet, which the single container group cannot give each of them
+var podSpecificFieldPaths = []string{"metadata.name", "metadata.uid"}
+
+// Returned for pods sharing the container group of their ReplicaSet that use pod-specific fields
+var errPodSpecificField = errors.New("pod-specific field")
+
+// getEnvFromSourceValues returns every key of the config map or secret referenced by envFrom
+func (p *SaladCloudProvider) getEnvFromSourceValues(namespace string, envFrom corev1.EnvFromSource) (map[string]string, error) {
+	values := make(map[string]string)
+	if ref := envFrom.ConfigMapRef; ref != nil {
+		configMap, err := p.configMapLister.ConfigMaps(namespace).Get(ref.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return values, nil
+			}
+			return nil, fmt.Errorf("failed to get config map %s/%s: %w", namespace, ref.Name, err)
+		}
+		for key, value := range configMap.Data {
+			values[key] = value
+		}
+	}
+	if ref := envFrom.SecretRef; ref != nil {
+		secret, err := p.secretLister.Secrets(namespace).Get(ref.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return values, nil
+			}
+			return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, ref.Name, err)
+		}
+		for key, value := range secret.Data {
+			values[key] = string(value)
+		}
+	}
+	return values, nil
+}
+
+// getEnvVarSourceValue resolves a single valueFrom reference. It returns false when an optional
+// reference could not be resolved and the variable should be left unset.
+func (p *SaladCloudProvider) getEnvVarSourceValue(pod *corev1.Pod, container corev1.Container, source *corev1.EnvVarSource) (string, bool, error) {
+	switch {
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		secret, err := p.secretLister.Secrets(pod.Namespace).Get(ref.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed to get secret %s/%s: %w", pod.Namespace, ref.Name, err)
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			if isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("key %q not found in secret %s/%s", ref.Key, pod.Namespace, ref.Name)
+		}
+		return string(value), true, nil
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		configMap, err := p.configMapLister.ConfigMaps(pod.Namespace).Get(ref.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed to get config map %s/%s: %w", pod.Namespace, ref.Name, err)
+		}
+		if value, ok := configMap.Data[ref.Key]; ok {
+			return value, true, nil
+		}
+		if value, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(value), true, nil
+		}
+		if isOptional(ref.Optional) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("key %q not found in config map %s/%s", ref.Key, pod.Namespace, ref.Name)
+	case source.FieldRef != nil:
+		if p.getReplicaSetOwner(pod) != nil && slices.Contains(podSpecificFieldPaths, source.FieldRef.FieldPath) {
+			return "", false, fmt.Errorf("%w: %s differs between the pods sharing the container group of their ReplicaSet", errPodSpecificField, source.FieldRef.FieldPath)
+		}
+		value, err := getPodFieldValue(pod, source.FieldRef.FieldPath)
+		return value, err == nil, err
+	case source.ResourceFieldRef != nil:
+		value, err := getContainerResourceValue(pod, container, source.ResourceFieldRef)
+		return value, err == nil, err
+	}
+	return "", false, fmt.Errorf("unsupported environment variable source")
+}
+
+// getPodFieldValue resolves a downward API field path against the pod
+func getPodFieldValue(pod *corev1.Pod, fieldPath string) (string, error) {
+	if matches := fieldPathSubscriptRegex.FindStringSubmatch(fieldPath); matches != nil {
+		if matches[1] == "metadata.labels" {
+			return pod.Labels[matches[2]], nil
+		}
+		return pod.Annotations[matches[2]], nil
+	}
+	switch fieldPath {
+	case "metadata.name":
+		return pod.Name, nil
+	case "metadata.namespace":
+		return pod.Namespace, nil
+	case "metadata.uid":
+		return string(pod.UID), nil
+	case "metadata.labels":
+		return formatMap(pod.Labels), nil
+	case "metadata.annotations":
+		return formatMap(pod.Annotations), nil
+	case "spec.nodeName":
+		return pod.Spec.NodeName, nil
+	case "spec.serviceAccountName":
+		return pod.Spec.ServiceAccountName, nil
+	case "status.podIP", "status.podIPs":
+		// SaladCloud instances have no cluster IP, this is whatever the pod status reports
+		return pod.Status.PodIP, nil
+	case "status.hostIP", "status.hostIPs":
+		return pod.Status.HostIP, nil
+	}
+	return "", fmt.Errorf("unsupported field path %q", fieldPath)
+}
+
+// getContainerResourceValue resolves a resourceFieldRef. Limits resolve to the resources the
+// container is actually given on SaladCloud.
+func getContainerResourceValue(pod *corev1.Pod, container corev1.Container, ref *corev1.ResourceFieldSelector) (string, error) {
+	if ref.ContainerName != "" && ref.ContainerName != container.Name {
+		found := false
+		for _, c := range pod.Spec.Containers {
+			if c.Name == ref.ContainerName {
+				container = c
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("container %q not found", ref.ContainerName)
+		}
+	}
+	cpu, memory := utils.GetContainerResource(container)
+	allocated := corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewQuantity(cpu, resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(memory*1024*1024, resource.BinarySI),
+	}
+
+	var quantity resource.Quantity
+	switch ref.Resource {
+	case "limits.cpu":
+		quantity = allocated[corev1.ResourceCPU]
+	case "limits.memory":
+		quantity = allocated[corev1.ResourceMemory]
+	case "requests.cpu":
+		quantity = *container.Resources.Requests.Cpu()
+	case "requests.memory":
+		quantity = *container.Resources.Requests.Memory()
+	default:
+		return "", fmt.Errorf("unsupported resource %q", ref.Resource)
+	}
+
+	divisor := ref.Divisor
+	if divisor.IsZero() {
+		divisor = resource.MustParse("1")
+	}
+	if strings.HasSuffix(ref.Resource, ".cpu") {
+		return strconv.FormatInt(int64(math.Ceil(float64(quantity.MilliValue())/float64(divisor.MilliValue()))), 10), nil
+	}
+	return strconv.FormatInt(int64(math.Ceil(float64(quantity.Value())/float64(divisor.Value()))), 10), nil
+}
+
+// formatMap renders labels or annotations the way the downward API volume does
+func formatMap(values map[string]string) string {
+	lines := make([]string, 0, len(values))
+	for key, value := range values {
+		lines = append(lines, fmt.Sprintf("%s=%q", key, value))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_getContainerEnvironment(t *testing.T) {
+	p, _ := newProvider()
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = secrets.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "creds"},
+		Data:       map[string][]byte{"password": []byte("hunter2"), "user": []byte("admin")},
+	})
+	configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = configMaps.Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "settings"},
+		Data:       map[string]string{"MODE": "fast", "LEVEL": "3"},
+	})
+	p.secretLister = corev1listers.NewSecretLister(secrets)
+	p.configMapLister = corev1listers.NewConfigMapLister(configMaps)
+
+	optional := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			Labels:    map[string]string{"app": "web"},
+		},
+	}
+	container := corev1.Container{
+		Name: "web",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+		},
+		EnvFrom: []corev1.EnvFromSource{
+			{Prefix: "CFG_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}},
+		},
+		Env: []corev1.EnvVar{
+			{Name: "CFG_MODE", Value: "slow"},
+			{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "password"}}},
+			{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "token", Optional: &optional}}},
+			{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+			{Name: "APP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['app']"}}},
+			{Name: "MEMORY_MB", ValueFrom: &corev1.EnvVarSource{ResourceFieldRef: &corev1.ResourceFieldSelector{
+				Resource: "requests.memory", Divisor: resource.MustParse("1Mi")}}},
+		},
+	}
+
+	env, err := p.getContainerEnvironment(pod, container)
+	require.NoError(t, err)
+	assert.Equal(t, "slow", env["CFG_MODE"])
+	assert.Equal(t, "3", env["CFG_LEVEL"])
+	assert.Equal(t, "hunter2", env["PASSWORD"])
+	assert.NotContains(t, env, "TOKEN")
+	assert.Equal(t, "default", env["POD_NAMESPACE"])
+	assert.Equal(t, "web", env["APP"])
+	assert.Equal(t, "2048", env["MEMORY_MB"])
+
+	// A missing required key fails
+	container.Env = append(container.Env, corev1.EnvVar{Name: "API_KEY", ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "api-key"}}})
+	_, err = p.getContainerEnvironment(pod, container)
+	assert.ErrorContains(t, err, `key "api-key" not found in secret default/creds`)
+}
+
+func Test_CreatePod_missingReference(t *testing.T) {
+	p, _ := newProvider()
+	p.secretLister = corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "web",
+			Image: "web:1",
+			Env: []corev1.EnvVar{{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}, Key: "password"}}}},
+		}}},
+	}
+
+	// The pod controller retries, and the pod tells why it is stuck
+	assert.Error(t, p.CreatePod(context.Background(), pod))
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning CreateContainerConfigError")
+	assert.Contains(t, event, "secret default/creds")
+}
+
+func Test_getContainerEnvironment_replicaSet(t *testing.T) {
+	p, _ := newProvider()
+	p.inputVars.ReplicaSetContainerGroups = true
+	pod := newReplicaSetPod("api-1", "rs-uid")
+	container := corev1.Container{Name: "api", Env: []corev1.EnvVar{
+		{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+	}}
+
+	// Fields shared by the pods of the ReplicaSet are fine
+	env, err := p.getContainerEnvironment(pod, container)
+	require.NoError(t, err)
+	assert.Equal(t, "default", env["POD_NAMESPACE"])
+
+	// But a single container group cannot tell each pod its name
+	container.Env = append(container.Env, corev1.EnvVar{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{
+		FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}})
+	_, err = p.getContainerEnvironment(pod, container)
+	assert.ErrorIs(t, err, errPodSpecificField)
+	assert.True(t, isPodSpecError(err))
+}
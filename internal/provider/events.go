@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the Kubernetes events recorded on pods
+const (
+	eventReasonContainerGroupCreated      = "ContainerGroupCreated"
+	eventReasonContainerGroupCreateFailed = "ContainerGroupCreateFailed"
+	eventReasonContainerGroupDeploying    = "ContainerGroupDeploying"
+	eventReasonInstanceAllocated          = "InstanceAllocated"
+	eventReasonContainerGroupRunning      = "ContainerGroupRunning"
+	eventReasonInstanceReallocated        = "InstanceReallocated"
+	eventReasonContainerGroupStopped      = "ContainerGroupStopped"
+	eventReasonContainerGroupFailed       = "ContainerGroupFailed"
+	eventReasonContainerGroupDeleted      = "ContainerGroupDeleted"
+	eventReasonContainerGroupDeleteFailed = "ContainerGroupDeleteFailed"
+	eventReasonContainerGroupUpdated      = "ContainerGroupUpdated"
+	eventReasonContainerGroupRecreated    = "ContainerGroupRecreated"
+	eventReasonContainerGroupDrifted      = "ContainerGroupDrifted"
+	eventReasonContainerGroupUpdateFailed = "ContainerGroupUpdateFailed"
+	eventReasonContainerGroupScaled       = "ContainerGroupScaled"
+	eventReasonContainerConfigError       = "CreateContainerConfigError"
+	eventReasonInvalidGPUClass            = "InvalidGPUClass"
+	eventReasonAccessDomainServiceCreated = "AccessDomainServiceCreated"
+)
+
+// lifecycleState is the part of a container group state that lifecycle events are derived from
+type lifecycleState struct {
+	status    saladclient.ContainerGroupStatus
+	allocated int32
+	running   int32
+}
+
+// lifecycleTracker remembers the last observed state of every container group, so that each
+// transition is recorded as an event only once, and the container groups stopped by this process
+type lifecycleTracker struct {
+	mu      sync.Mutex
+	states  map[string]lifecycleState
+	stopped map[string]bool
+}
+
+func newLifecycleTracker() *lifecycleTracker {
+	return &lifecycleTracker{states: make(map[string]lifecycleState), stopped: make(map[string]bool)}
+}
+
+// created starts tracking a container group from scratch, so that its whole lifecycle is reported
+func (lt *lifecycleTracker) created(containerGroupName string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.states[containerGroupName] = lifecycleState{}
+	delete(lt.stopped, containerGroupName)
+}
+
+func (lt *lifecycleTracker) deleted(containerGroupName string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.states, containerGroupName)
+	delete(lt.stopped, containerGroupName)
+}
+
+// stopping remembers that the container group was asked to stop, which takes a while
+func (lt *lifecycleTracker) stopping(containerGroupName string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.stopped[containerGroupName] = true
+}
+
+func (lt *lifecycleTracker) isStopping(containerGroupName string) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	return lt.stopped[containerGroupName]
+}
+
+// observe stores the current state and returns the previous one. Container groups that were not
+// created by this process have no previous state, their current state is only the baseline.
+func (lt *lifecycleTracker) observe(containerGroup *saladclient.ContainerGroup) (lifecycleState, lifecycleState, bool) {
+	counts := containerGroup.CurrentState.InstanceStatusCounts
+	current := lifecycleState{
+		status:    containerGroup.CurrentState.Status,
+		allocated: counts.CreatingCount + counts.RunningCount,
+		running:   counts.RunningCount,
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	previous, ok := lt.states[containerGroup.Name]
+	lt.states[containerGroup.Name] = current
+	return previous, current, ok
+}
+
+// recordLifecycleEvents records an event on the pod for every transition of its container group
+// since the last time it was observed
+func (p *SaladCloudProvider) recordLifecycleEvents(namespace, name string, containerGroup *saladclient.ContainerGroup) {
+	previous, current, ok := p.lifecycle.observe(containerGroup)
+	if !ok || previous == current || p.podLister == nil {
+		return
+	}
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return
+	}
+
+	if current.status != previous.status {
+		switch current.status {
+		case saladclient.CONTAINERGROUPSTATUS_DEPLOYING:
+			p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupDeploying, "Container group %s is deploying", containerGroup.Name)
+		case saladclient.CONTAINERGROUPSTATUS_STOPPED, saladclient.CONTAINERGROUPSTATUS_SUCCEEDED:
+			p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupStopped, "Container group %s is %s", containerGroup.Name, current.status)
+		case saladclient.CONTAINERGROUPSTATUS_FAILED:
+			p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupFailed, "Container group %s failed%s", containerGroup.Name, getStateDescription(containerGroup))
+		}
+	}
+	if current.allocated > previous.allocated {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonInstanceAllocated, "%d of %d instances of container group %s allocated",
+			current.allocated, containerGroup.Replicas, containerGroup.Name)
+	}
+	if current.running > 0 && previous.running == 0 {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupRunning, "Container group %s is running", containerGroup.Name)
+	}
+	if current.running < previous.running && current.status == saladclient.CONTAINERGROUPSTATUS_RUNNING {
+		// SaladCloud moves instances to another machine when theirs goes away
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonInstanceReallocated, "%d instances of container group %s are being reallocated",
+			previous.running-current.running, containerGroup.Name)
+	}
+}
+
+func getStateDescription(containerGroup *saladclient.ContainerGroup) string {
+	description := containerGroup.CurrentState.GetDescription()
+	if description == "" {
+		return ""
+	}
+	return fmt.Sprintf(": %s", description)
+}
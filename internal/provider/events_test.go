@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_recordLifecycleEvents(t *testing.T) {
+	p, _ := newProvider()
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+	p.podLister = newTestPodLister(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}})
+
+	containerGroup := newTestContainerGroup("default-web", "nginx")
+	observe := func(status saladclient.ContainerGroupStatus, creating, running int32) []string {
+		containerGroup.CurrentState.Status = status
+		containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, creating, running, 0)
+		p.recordLifecycleEvents("default", "web", &containerGroup)
+		events := make([]string, 0)
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	// Container groups this node did not create are only observed
+	assert.Empty(t, observe(saladclient.CONTAINERGROUPSTATUS_RUNNING, 0, 1))
+
+	p.lifecycle.created("default-web")
+	assert.Equal(t, []string{"Normal ContainerGroupDeploying Container group default-web is deploying"},
+		observe(saladclient.CONTAINERGROUPSTATUS_DEPLOYING, 0, 0))
+	assert.Equal(t, []string{"Normal InstanceAllocated 1 of 1 instances of container group default-web allocated"},
+		observe(saladclient.CONTAINERGROUPSTATUS_DEPLOYING, 1, 0))
+	assert.Equal(t, []string{"Normal ContainerGroupRunning Container group default-web is running"},
+		observe(saladclient.CONTAINERGROUPSTATUS_RUNNING, 0, 1))
+	// Unchanged states are not reported twice
+	assert.Empty(t, observe(saladclient.CONTAINERGROUPSTATUS_RUNNING, 0, 1))
+	assert.Equal(t, []string{"Warning InstanceReallocated 1 instances of container group default-web are being reallocated"},
+		observe(saladclient.CONTAINERGROUPSTATUS_RUNNING, 0, 0))
+	assert.Equal(t, []string{"Warning ContainerGroupFailed Container group default-web failed"},
+		observe(saladclient.CONTAINERGROUPSTATUS_FAILED, 0, 0))
+}
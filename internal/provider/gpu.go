@@ -0,0 +1,281 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// Default extended resource of GPU pods that may run on any GPU class
+	DefaultGPUResourceName = "nvidia.com/gpu"
+	// Prefix of the extended resources of single GPU classes, such as salad.com/gpu-rtx4090
+	gpuClassResourcePrefix = "salad.com/gpu-"
+	gpuClassesAnnotation   = "salad.com/gpu-classes"
+)
+
+// Returned for GPU class names and IDs that are not in the catalog of the organization
+var errUnknownGPUClass = errors.New("unknown GPU class")
+
+// getGPUClassResourceName returns the extended resource of a GPU class, "RTX 4090 (24 GB)"
+// becomes salad.com/gpu-rtx-4090-24-gb
+func getGPUClassResourceName(className string) corev1.ResourceName {
+	suffix := strings.Trim(nonAlphanumerics.ReplaceAllString(strings.ToLower(className), "-"), "-")
+	return corev1.ResourceName(gpuClassResourcePrefix + suffix)
+}
+
+// getGPUClassResources maps the extended resource of every GPU class to the class name or ID. The
+// configured class table comes first, otherwise every GPU class of the organization is advertised.
+func (p *SaladCloudProvider) getGPUClassResources(ctx context.Context) (map[corev1.ResourceName]string, error) {
+	resources := make(map[corev1.ResourceName]string)
+	if len(p.inputVars.GPUClassResources) > 0 {
+		for suffix, class := range p.inputVars.GPUClassResources {
+			resources[corev1.ResourceName(gpuClassResourcePrefix+suffix)] = class
+		}
+		return resources, nil
+	}
+	gpuClasses, err := p.listGPUClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, gpuClass := range gpuClasses {
+		resources[getGPUClassResourceName(gpuClass.Name)] = gpuClass.Id
+	}
+	return resources, nil
+}
+
+// listGPUClasses returns the GPU classes of the organization from the shared catalog
+func (p *SaladCloudProvider) listGPUClasses(ctx context.Context) ([]saladclient.GpuClass, error) {
+	return p.gpuClassCatalog.get(ctx, func(ctx context.Context) ([]saladclient.GpuClass, error) {
+		listCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+		defer cancel()
+		classes, _, err := p.apiClient.OrganizationDataAPI.ListGpuClasses(listCtx, p.inputVars.OrganizationName).Execute()
+		if err != nil {
+			p.logger.WithError(err).Errorf("Failed to get gpuClasses")
+			return nil, err
+		}
+		return classes.Items, nil
+	})
+}
+
+// addGPUResources advertises the GPU resources of the node. SaladCloud instances have a single
+// GPU, so the node fits as many GPUs of every kind as it fits pods.
+func (p *SaladCloudProvider) addGPUResources(ctx context.Context, capacity, allocatable corev1.ResourceList) {
+	if p.inputVars.GPUResourceName == "" {
+		return
+	}
+	resourceNames := []corev1.ResourceName{corev1.ResourceName(p.inputVars.GPUResourceName)}
+	classResources, err := p.getGPUClassResources(ctx)
+	if err != nil {
+		p.logger.WithError(err).Warnf("addGPUResources: failed to get GPU classes, advertising %s only", p.inputVars.GPUResourceName)
+	}
+	for resourceName := range classResources {
+		resourceNames = append(resourceNames, resourceName)
+	}
+	for _, resourceName := range resourceNames {
+		capacity[resourceName] = capacity[corev1.ResourcePods].DeepCopy()
+		allocatable[resourceName] = allocatable[corev1.ResourcePods].DeepCopy()
+	}
+}
+
+// getGPURequests returns the GPU resources requested by the container. Extended resources are
+// set as limits, requests default to them.
+func (p *SaladCloudProvider) getGPURequests(container corev1.Container) map[corev1.ResourceName]resource.Quantity {
+	gpuRequests := make(map[corev1.ResourceName]resource.Quantity)
+	for _, resources := range []corev1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+		for resourceName, quantity := range resources {
+			isGPU := p.inputVars.GPUResourceName != "" && string(resourceName) == p.inputVars.GPUResourceName
+			if (isGPU || strings.HasPrefix(string(resourceName), gpuClassResourcePrefix)) && !quantity.IsZero() {
+				gpuRequests[resourceName] = quantity
+			}
+		}
+	}
+	return gpuRequests
+}
+
+// validateGPURequests rejects containers that cannot run on a single GPU SaladCloud instance
+func (p *SaladCloudProvider) validateGPURequests(container corev1.Container) error {
+	for resourceName, quantity := range p.getGPURequests(container) {
+		if quantity.Cmp(*resource.NewQuantity(1, resource.DecimalSI)) > 0 {
+			return fmt.Errorf("container %s requests %s %s but SaladCloud instances have a single GPU", container.Name, quantity.String(), resourceName)
+		}
+	}
+	return nil
+}
+
+// getGPUClasses returns the IDs of the GPU classes the container may run on, from the
+// salad.com/gpu-classes annotation and from the GPU resources of the container
+func (p *SaladCloudProvider) getGPUClasses(ctx context.Context, pod *corev1.Pod, container corev1.Container) ([]string, error) {
+	requested := make([]string, 0)
+	if gpuRequestedString, ok := pod.Annotations[gpuClassesAnnotation]; ok {
+		requested = append(requested, strings.Split(gpuRequestedString, ",")...)
+	}
+
+	gpuRequests := p.getGPURequests(container)
+	if len(gpuRequests) > 0 {
+		classResources, err := p.getGPUClassResources(ctx)
+		if err != nil {
+			return nil, err
+		}
+		anyClass := false
+		for resourceName := range gpuRequests {
+			if class, ok := classResources[resourceName]; ok {
+				requested = append(requested, class)
+			} else if string(resourceName) == p.inputVars.GPUResourceName {
+				anyClass = true
+			} else {
+				err := fmt.Errorf("%w resource %s", errUnknownGPUClass, resourceName)
+				p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonInvalidGPUClass, "%s", err)
+				return nil, err
+			}
+		}
+		if anyClass && len(requested) == 0 {
+			// The generic GPU resource runs on any advertised class
+			for _, class := range classResources {
+				requested = append(requested, class)
+			}
+			if len(requested) == 0 {
+				err := fmt.Errorf("%w: no GPU class is available for resource %s", errUnknownGPUClass, p.inputVars.GPUResourceName)
+				p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonInvalidGPUClass, "%s", err)
+				return nil, err
+			}
+		}
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	return p.resolveGPUClassIDs(ctx, pod, requested)
+}
+
+// resolveGPUClassIDs turns GPU class names and IDs into the IDs of known GPU classes. Any unknown
+// class fails the pod, as running it without the GPU it asked for is never what is wanted.
+func (p *SaladCloudProvider) resolveGPUClassIDs(ctx context.Context, pod *corev1.Pod, requested []string) ([]string, error) {
+	gpuClasses, err := p.listGPUClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	saladClientGpuIds := make([]string, 0, len(requested))
+	seen := make(map[string]bool)
+	unknown := make([]string, 0)
+	for _, gpu := range requested {
+		if strings.TrimSpace(gpu) == "" {
+			continue
+		}
+		ids := matchGPUClasses(gpuClasses, gpu)
+		if len(ids) == 0 {
+			unknown = append(unknown, strconv.Quote(strings.TrimSpace(gpu)))
+			continue
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				saladClientGpuIds = append(saladClientGpuIds, id)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		err := fmt.Errorf("%w %s", errUnknownGPUClass, strings.Join(unknown, ", "))
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonInvalidGPUClass, "%s, known GPU classes are %s", err, getGPUClassNames(gpuClasses))
+		return nil, err
+	}
+	return saladClientGpuIds, nil
+}
+
+// matchGPUClasses returns the IDs of the GPU classes named by a class ID or name. Names match
+// regardless of case, spacing and punctuation, with or without vendor prefixes, and without the
+// VRAM suffix they match every class of the GPU model, so "RTX 3060" matches "RTX 3060 (12 GB)".
+func matchGPUClasses(gpuClasses []saladclient.GpuClass, gpu string) []string {
+	gpu = strings.TrimSpace(strings.ToLower(gpu))
+	if _, err := uuid.Parse(gpu); err == nil {
+		for _, gpuClass := range gpuClasses {
+			if strings.EqualFold(gpuClass.Id, gpu) {
+				return []string{gpuClass.Id}
+			}
+		}
+		return nil
+	}
+
+	name := normalizeGPUClassName(gpu)
+	if name == "" {
+		return nil
+	}
+	for _, gpuClass := range gpuClasses {
+		if normalizeGPUClassName(gpuClass.Name) == name {
+			return []string{gpuClass.Id}
+		}
+	}
+	ids := make([]string, 0)
+	for _, gpuClass := range gpuClasses {
+		if normalizeGPUClassName(gpuVRAMSuffix.ReplaceAllString(gpuClass.Name, "")) == name {
+			ids = append(ids, gpuClass.Id)
+		}
+	}
+	return ids
+}
+
+var (
+	gpuVRAMSuffix    = regexp.MustCompile(`(?i)[\s(-]*\d+\s*gb\)?\s*$`)
+	gpuVendorPrefix  = regexp.MustCompile(`^(nvidia|geforce|amd|radeon)+`)
+	nonAlphanumerics = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// normalizeGPUClassName reduces "NVIDIA GeForce RTX 4090 (24 GB)" to "rtx409024gb"
+func normalizeGPUClassName(name string) string {
+	name = nonAlphanumerics.ReplaceAllString(strings.ToLower(name), "")
+	return gpuVendorPrefix.ReplaceAllString(name, "")
+}
+
+func getGPUClassNames(gpuClasses []saladclient.GpuClass) string {
+	names := make([]string, 0, len(gpuClasses))
+	for _, gpuClass := range gpuClasses {
+		names = append(names, strconv.Quote(gpuClass.Name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// How long the GPU class catalog is used before it is fetched again
+var gpuClassCatalogTTL = 10 * time.Minute
+
+// gpuClassCatalog caches the GPU classes of the organization, they rarely change
+type gpuClassCatalog struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	classes []saladclient.GpuClass
+	fetched time.Time
+}
+
+func newGPUClassCatalog(ttl time.Duration) *gpuClassCatalog {
+	return &gpuClassCatalog{ttl: ttl}
+}
+
+// get returns the cached classes, fetching them again once they are older than the TTL. A failed
+// fetch falls back to the stale classes, if any.
+func (c *gpuClassCatalog) get(ctx context.Context, fetch func(context.Context) ([]saladclient.GpuClass, error)) ([]saladclient.GpuClass, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.classes != nil && time.Since(c.fetched) < c.ttl {
+		return c.classes, nil
+	}
+	classes, err := fetch(ctx)
+	if err != nil {
+		if c.classes != nil {
+			return c.classes, nil
+		}
+		return nil, err
+	}
+	c.classes = classes
+	c.fetched = time.Now()
+	return classes, nil
+}
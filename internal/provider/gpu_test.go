@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	rtx4090ClassID = "ed563892-aacd-40f5-80b7-90c9be6c759b"
+	rtx3090ClassID = "a5db5c50-cbcb-4596-ae80-6a0c8090d80f"
+)
+
+var testGPUClasses = []saladclient.GpuClass{
+	*saladclient.NewGpuClass(rtx4090ClassID, "RTX 4090 (24 GB)", []saladclient.GpuClassPrice{}),
+	*saladclient.NewGpuClass(rtx3090ClassID, "RTX 3090 (24 GB)", []saladclient.GpuClassPrice{}),
+}
+
+func newGPUTestProvider(t *testing.T) *SaladCloudProvider {
+	p, _ := newGPUTestProviderWithCalls(t)
+	return p
+}
+
+func newGPUTestProviderWithCalls(t *testing.T) (*SaladCloudProvider, *int) {
+	calls := 0
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(saladclient.NewGpuClassesList(testGPUClasses))
+	}))
+	p.inputVars.GPUResourceName = DefaultGPUResourceName
+	return p, &calls
+}
+
+func newGPUContainer(resourceName corev1.ResourceName, count int64) corev1.Container {
+	return corev1.Container{
+		Name: "main",
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{resourceName: *resource.NewQuantity(count, resource.DecimalSI)},
+		},
+	}
+}
+
+func Test_getGPUClasses(t *testing.T) {
+	p := newGPUTestProvider(t)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	// The generic GPU resource runs on any GPU class
+	classes, err := p.getGPUClasses(context.Background(), pod, newGPUContainer(DefaultGPUResourceName, 1))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{rtx4090ClassID, rtx3090ClassID}, classes)
+
+	classes, err = p.getGPUClasses(context.Background(), pod, newGPUContainer("salad.com/gpu-rtx-4090-24-gb", 1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{rtx4090ClassID}, classes)
+
+	// The class table names the resources
+	p.inputVars.GPUClassResources = map[string]string{"rtx3090": "RTX 3090 (24 GB)"}
+	classes, err = p.getGPUClasses(context.Background(), pod, newGPUContainer("salad.com/gpu-rtx3090", 1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{rtx3090ClassID}, classes)
+
+	// The annotation narrows the generic GPU resource
+	pod.Annotations = map[string]string{gpuClassesAnnotation: "rtx 4090 (24 gb)"}
+	classes, err = p.getGPUClasses(context.Background(), pod, newGPUContainer(DefaultGPUResourceName, 1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{rtx4090ClassID}, classes)
+
+	classes, err = p.getGPUClasses(context.Background(), &corev1.Pod{}, corev1.Container{})
+	require.NoError(t, err)
+	assert.Nil(t, classes)
+}
+
+func Test_validateGPURequests(t *testing.T) {
+	p := newGPUTestProvider(t)
+	assert.NoError(t, p.validateGPURequests(newGPUContainer(DefaultGPUResourceName, 1)))
+	assert.Error(t, p.validateGPURequests(newGPUContainer(DefaultGPUResourceName, 2)))
+}
+
+func Test_addGPUResources(t *testing.T) {
+	p := newGPUTestProvider(t)
+	capacity, allocatable := p.getNodeResources(context.Background())
+	assert.Equal(t, resource.MustParse(DefaultNodePods), capacity[DefaultGPUResourceName])
+	assert.Equal(t, resource.MustParse(DefaultNodePods), allocatable["salad.com/gpu-rtx-4090-24-gb"])
+	assert.Contains(t, capacity, corev1.ResourceName("salad.com/gpu-rtx-3090-24-gb"))
+}
+
+func Test_getGPUClasses_unknown(t *testing.T) {
+	p, calls := newGPUTestProviderWithCalls(t)
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: map[string]string{
+		gpuClassesAnnotation: "rtx 4090, gtx 1080, 8b2e0c4b-0fb0-4a8b-9ea5-0e6c2c3f1c1d",
+	}}}
+
+	_, err := p.getGPUClasses(context.Background(), pod, corev1.Container{})
+	assert.ErrorIs(t, err, errUnknownGPUClass)
+	assert.Equal(t, `Warning InvalidGPUClass unknown GPU class "gtx 1080", "8b2e0c4b-0fb0-4a8b-9ea5-0e6c2c3f1c1d", `+
+		`known GPU classes are "RTX 3090 (24 GB)", "RTX 4090 (24 GB)"`, <-recorder.Events)
+
+	// The catalog is fetched once
+	_, err = p.getGPUClasses(context.Background(), pod, corev1.Container{})
+	assert.ErrorIs(t, err, errUnknownGPUClass)
+	assert.Equal(t, 1, *calls)
+}
+
+func Test_getGPUClasses_noClasses(t *testing.T) {
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(saladclient.NewGpuClassesList([]saladclient.GpuClass{}))
+	}))
+	p.inputVars.GPUResourceName = DefaultGPUResourceName
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	// The generic GPU resource never runs without a GPU
+	_, err := p.getGPUClasses(context.Background(), pod, newGPUContainer(DefaultGPUResourceName, 1))
+	assert.ErrorIs(t, err, errUnknownGPUClass)
+	assert.Contains(t, <-recorder.Events, "Warning InvalidGPUClass")
+}
+
+func Test_matchGPUClasses(t *testing.T) {
+	gpuClasses := append([]saladclient.GpuClass{
+		*saladclient.NewGpuClass("3060-8", "RTX 3060 (8 GB)", []saladclient.GpuClassPrice{}),
+		*saladclient.NewGpuClass("3060-12", "RTX 3060 (12 GB)", []saladclient.GpuClassPrice{}),
+	}, testGPUClasses...)
+	tests := map[string][]string{
+		"RTX 4090 (24 GB)":              {rtx4090ClassID},
+		"rtx4090-24gb":                  {rtx4090ClassID},
+		"NVIDIA GeForce RTX 4090":       {rtx4090ClassID},
+		"RTX 3060 12GB":                 {"3060-12"},
+		"rtx3060":                       {"3060-8", "3060-12"},
+		strings.ToUpper(rtx3090ClassID): {rtx3090ClassID},
+		"rtx 5090":                      {},
+		"":                              {},
+	}
+	for gpu, want := range tests {
+		assert.ElementsMatch(t, want, matchGPUClasses(gpuClasses, gpu), gpu)
+	}
+}
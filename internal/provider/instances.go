@@ -0,0 +1,346 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Instances are listed again once the state of their container group changes, or after the
+// refresh interval. The interval doubles every time the instances are found unchanged, up to the
+// longest one, so that quiet container groups cost few API calls.
+var (
+	instancesRefreshInterval    = 30 * time.Second
+	maxInstancesRefreshInterval = 5 * time.Minute
+)
+
+// Pod conditions reporting the SaladCloud instance running the pod
+const (
+	podConditionInstanceAllocated corev1.PodConditionType = "salad.com/InstanceAllocated"
+	podConditionInstanceRunning   corev1.PodConditionType = "salad.com/InstanceRunning"
+)
+
+// Waiting reasons of containers whose instance is not running yet
+var instanceWaitingReasons = map[saladclient.ContainerGroupInstanceState]string{
+	saladclient.CONTAINERGROUPINSTANCESTATE_ALLOCATING:  "Allocating",
+	saladclient.CONTAINERGROUPINSTANCESTATE_DOWNLOADING: "Downloading",
+	saladclient.CONTAINERGROUPINSTANCESTATE_CREATING:    "Creating",
+	saladclient.CONTAINERGROUPINSTANCESTATE_STOPPING:    "Stopping",
+}
+
+// Order of the instance states from the most to the least advanced, stopping instances are on their way out
+var instanceStateRanks = map[saladclient.ContainerGroupInstanceState]int{
+	saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING:     0,
+	saladclient.CONTAINERGROUPINSTANCESTATE_CREATING:    1,
+	saladclient.CONTAINERGROUPINSTANCESTATE_DOWNLOADING: 2,
+	saladclient.CONTAINERGROUPINSTANCESTATE_ALLOCATING:  3,
+	saladclient.CONTAINERGROUPINSTANCESTATE_STOPPING:    4,
+}
+
+// instancesSnapshot is what is known of the instances of a container group at some point
+type instancesSnapshot struct {
+	instances      []saladclient.ContainerGroupInstance
+	workloadErrors []saladclient.WorkloadError
+}
+
+// instancesEntry holds the last listed instances of a container group
+type instancesEntry struct {
+	instancesSnapshot
+	state           saladclient.ContainerGroupState
+	fetchTime       time.Time
+	refreshInterval time.Duration
+}
+
+// instancesTracker caches the instances and the workload errors of every container group, so that
+// pod statuses only list them again when the container group changes
+type instancesTracker struct {
+	mu      sync.Mutex
+	entries map[string]*instancesEntry
+}
+
+func newInstancesTracker() *instancesTracker {
+	return &instancesTracker{entries: make(map[string]*instancesEntry)}
+}
+
+// cached returns the instances of the container group when they are still current
+func (it *instancesTracker) cached(containerGroup *saladclient.ContainerGroup, now time.Time) (instancesSnapshot, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	entry, ok := it.entries[containerGroup.Name]
+	if !ok || !isSameInstancesState(entry.state, containerGroup.CurrentState) {
+		return instancesSnapshot{}, false
+	}
+	if now.Sub(entry.fetchTime) >= entry.refreshInterval {
+		return instancesSnapshot{}, false
+	}
+	return entry.instancesSnapshot, true
+}
+
+// stale returns the last listed instances of the container group, whatever their age
+func (it *instancesTracker) stale(containerGroupName string) (instancesSnapshot, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	entry, ok := it.entries[containerGroupName]
+	if !ok {
+		return instancesSnapshot{}, false
+	}
+	return entry.instancesSnapshot, true
+}
+
+// changed reports whether freshly listed instances differ from the last ones, in which case the
+// workload errors are listed again too, as a failed instance is replaced or starts over
+func (it *instancesTracker) changed(containerGroup *saladclient.ContainerGroup, instances []saladclient.ContainerGroupInstance) bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	entry, ok := it.entries[containerGroup.Name]
+	return !ok || entry.workloadErrors == nil || !isSameInstancesState(entry.state, containerGroup.CurrentState) ||
+		!isSameInstances(entry.instances, instances)
+}
+
+// observe stores freshly listed instances, and the workload errors when they were listed, and
+// returns the up to date snapshot of the container group
+func (it *instancesTracker) observe(containerGroup *saladclient.ContainerGroup, instances []saladclient.ContainerGroupInstance, workloadErrors []saladclient.WorkloadError, now time.Time) instancesSnapshot {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	entry, ok := it.entries[containerGroup.Name]
+	if !ok {
+		entry = &instancesEntry{}
+		it.entries[containerGroup.Name] = entry
+	}
+	if ok && isSameInstancesState(entry.state, containerGroup.CurrentState) && isSameInstances(entry.instances, instances) {
+		entry.refreshInterval = min(2*entry.refreshInterval, maxInstancesRefreshInterval)
+	} else {
+		entry.refreshInterval = instancesRefreshInterval
+	}
+	entry.state = containerGroup.CurrentState
+	entry.fetchTime = now
+	entry.instances = instances
+	if workloadErrors != nil {
+		entry.workloadErrors = workloadErrors
+	}
+	return entry.instancesSnapshot
+}
+
+// forget drops the instances of a deleted container group
+func (it *instancesTracker) forget(containerGroupName string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	delete(it.entries, containerGroupName)
+}
+
+// isSameInstancesState reports whether a container group state leaves its instances as they were
+func isSameInstancesState(a, b saladclient.ContainerGroupState) bool {
+	return a.Status == b.Status && a.InstanceStatusCounts == b.InstanceStatusCounts
+}
+
+// isSameInstances reports whether two listings of the instances of a container group are alike
+func isSameInstances(a, b []saladclient.ContainerGroupInstance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byID := make(map[string]saladclient.ContainerGroupInstance, len(a))
+	for _, instance := range a {
+		byID[instance.Id] = instance
+	}
+	for _, instance := range b {
+		previous, ok := byID[instance.Id]
+		if !ok || previous.State != instance.State || !previous.UpdateTime.Equal(instance.UpdateTime) ||
+			previous.GetReady() != instance.GetReady() || previous.GetStarted() != instance.GetStarted() {
+			return false
+		}
+	}
+	return true
+}
+
+// getContainerGroupInstances returns the instances of the container group and its workload errors.
+// The last listed instances are kept when listing them fails.
+func (p *SaladCloudProvider) getContainerGroupInstances(ctx context.Context, containerGroup *saladclient.ContainerGroup) (instancesSnapshot, error) {
+	now := time.Now()
+	if snapshot, ok := p.instances.cached(containerGroup, now); ok {
+		return snapshot, nil
+	}
+	listCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	collection, r, err := p.apiClient.ContainerGroupsAPI.ListContainerGroupInstances(listCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroup.Name).Execute()
+	if err != nil {
+		if snapshot, ok := p.instances.stale(containerGroup.Name); ok {
+			p.logger.WithError(err).Warnf("getContainerGroupInstances: failed to list instances of %s, using the last listed ones", containerGroup.Name)
+			return snapshot, nil
+		}
+		return instancesSnapshot{}, models.NewSaladCloudError(err, r)
+	}
+	var workloadErrors []saladclient.WorkloadError
+	if p.instances.changed(containerGroup, collection.Instances) {
+		workloadErrors, err = p.getWorkloadErrors(ctx, containerGroup.Name)
+		if err != nil {
+			p.logger.WithError(err).Warnf("getContainerGroupInstances: failed to list workload errors of %s", containerGroup.Name)
+		}
+	}
+	return p.instances.observe(containerGroup, collection.Instances, workloadErrors, now), nil
+}
+
+// sortInstances orders instances from the most to the least advanced, then by ID
+func sortInstances(instances []saladclient.ContainerGroupInstance) []saladclient.ContainerGroupInstance {
+	sorted := append([]saladclient.ContainerGroupInstance(nil), instances...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if instanceStateRanks[a.State] != instanceStateRanks[b.State] {
+			return instanceStateRanks[a.State] < instanceStateRanks[b.State]
+		}
+		return a.Id < b.Id
+	})
+	return sorted
+}
+
+// getPodInstance picks the instance reported on the pod: the most advanced one, or for pods
+// sharing the container group of their ReplicaSet, the one at the rank of the pod
+func (p *SaladCloudProvider) getPodInstance(namespace, name string, owner *metav1.OwnerReference, instances []saladclient.ContainerGroupInstance) *saladclient.ContainerGroupInstance {
+	sorted := sortInstances(instances)
+	index := 0
+	if owner != nil {
+		pods, err := p.getReplicaSetPods(namespace, owner)
+		if err != nil {
+			return nil
+		}
+		index = -1
+		for i, pod := range pods {
+			if pod.Name == name {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 || index >= len(sorted) {
+		return nil
+	}
+	return &sorted[index]
+}
+
+// setInstanceStatus details the pod status with the state of the instance running the pod
+func (p *SaladCloudProvider) setInstanceStatus(ctx context.Context, namespace, name string, owner *metav1.OwnerReference, containerGroup *saladclient.ContainerGroup, status *corev1.PodStatus) {
+	groupStatus := containerGroup.CurrentState.Status
+	if groupStatus != saladclient.CONTAINERGROUPSTATUS_RUNNING && groupStatus != saladclient.CONTAINERGROUPSTATUS_FAILED {
+		return
+	}
+	snapshot, err := p.getContainerGroupInstances(ctx, containerGroup)
+	if err != nil {
+		p.logger.WithError(err).Errorf("setInstanceStatus: failed to list instances of %s", containerGroup.Name)
+		return
+	}
+	var instance *saladclient.ContainerGroupInstance
+	if groupStatus == saladclient.CONTAINERGROUPSTATUS_RUNNING {
+		instance = p.getPodInstance(namespace, name, owner, snapshot.instances)
+	}
+	// SaladCloud keeps the workload errors, so restarts survive restarts of the provider
+	terminations := getPodTerminations(snapshot.workloadErrors, owner, instance)
+	restarts := int32(len(terminations))
+
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		if isIgnoredContainerStatus(*containerStatus) {
+			continue
+		}
+		containerStatus.RestartCount = restarts
+		if instance != nil {
+			containerStatus.State = getInstanceContainerState(instance)
+			containerStatus.Started = instance.Started
+			containerStatus.Ready = isInstanceReady(instance, containerGroup)
+		}
+		setTerminationStatus(containerStatus, groupStatus, terminations, time.Now())
+	}
+	// A pod is Pending until its instance first runs. Pods never go back to Pending, an instance
+	// that starts over only leaves the container waiting and the pod not ready.
+	wasRunning := p.wasRunning(namespace, name)
+	if wasRunning && status.Phase == corev1.PodPending {
+		status.Phase = corev1.PodRunning
+	}
+	if instance == nil {
+		return
+	}
+
+	running := instance.State == saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING
+	if !running && !wasRunning && status.Phase == corev1.PodRunning {
+		status.Phase = corev1.PodPending
+	}
+	containersReady := areContainersReady(status.ContainerStatuses)
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == corev1.PodReady || status.Conditions[i].Type == corev1.ContainersReady {
+			status.Conditions[i].Status = getConditionStatus(containersReady)
+		}
+	}
+	status.Conditions = append(status.Conditions, getInstanceConditions(instance)...)
+}
+
+// wasRunning reports whether the pod was last reported Running
+func (p *SaladCloudProvider) wasRunning(namespace, name string) bool {
+	pod := p.getListedPod(namespace, name)
+	return pod != nil && pod.Status.Phase == corev1.PodRunning
+}
+
+// isInstanceReady reports whether an instance runs and passes the readiness probe of its container
+// group. Instances that do not report their readiness are only ready without a readiness probe.
+func isInstanceReady(instance *saladclient.ContainerGroupInstance, containerGroup *saladclient.ContainerGroup) bool {
+	if instance.State != saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING {
+		return false
+	}
+	if instance.Ready != nil {
+		return *instance.Ready
+	}
+	return containerGroup.ReadinessProbe == nil
+}
+
+// getInstanceContainerState maps the state of an instance to the state of the main container
+func getInstanceContainerState(instance *saladclient.ContainerGroupInstance) corev1.ContainerState {
+	if instance.State == saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING {
+		return corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(instance.UpdateTime)}}
+	}
+	var message string
+	switch instance.State {
+	case saladclient.CONTAINERGROUPINSTANCESTATE_ALLOCATING:
+		message = fmt.Sprintf("Instance %s is waiting for a machine", instance.Id)
+	case saladclient.CONTAINERGROUPINSTANCESTATE_DOWNLOADING:
+		message = fmt.Sprintf("Instance %s is downloading the image on machine %s", instance.Id, instance.MachineId)
+	case saladclient.CONTAINERGROUPINSTANCESTATE_CREATING:
+		message = fmt.Sprintf("Instance %s is creating the container on machine %s", instance.Id, instance.MachineId)
+	default:
+		message = fmt.Sprintf("Instance %s is %s on machine %s", instance.Id, instance.State, instance.MachineId)
+	}
+	return corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: instanceWaitingReasons[instance.State], Message: message}}
+}
+
+// getInstanceConditions reports the instance, its machine and the time of its last state change
+func getInstanceConditions(instance *saladclient.ContainerGroupInstance) []corev1.PodCondition {
+	transitionTime := metav1.NewTime(instance.UpdateTime)
+	allocated := instance.State != saladclient.CONTAINERGROUPINSTANCESTATE_ALLOCATING && instance.MachineId != ""
+	allocatedCondition := corev1.PodCondition{
+		Type:               podConditionInstanceAllocated,
+		Status:             getConditionStatus(allocated),
+		Reason:             "Allocating",
+		Message:            fmt.Sprintf("Instance %s is waiting for a machine", instance.Id),
+		LastTransitionTime: transitionTime,
+	}
+	if allocated {
+		allocatedCondition.Reason = "Allocated"
+		allocatedCondition.Message = fmt.Sprintf("Instance %s on machine %s", instance.Id, instance.MachineId)
+	}
+
+	running := instance.State == saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING
+	runningCondition := corev1.PodCondition{
+		Type:               podConditionInstanceRunning,
+		Status:             getConditionStatus(running),
+		Reason:             "Running",
+		Message:            fmt.Sprintf("Instance %s on machine %s, version %d", instance.Id, instance.MachineId, instance.Version),
+		LastTransitionTime: transitionTime,
+	}
+	if !running {
+		runningCondition.Reason = instanceWaitingReasons[instance.State]
+	}
+	return []corev1.PodCondition{allocatedCondition, runningCondition}
+}
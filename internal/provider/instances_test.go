@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestInstance(id string, state saladclient.ContainerGroupInstanceState) saladclient.ContainerGroupInstance {
+	return *saladclient.NewContainerGroupInstance(id, "machine-"+id, state, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), 1)
+}
+
+func Test_instancesTracker_cached(t *testing.T) {
+	tracker := newInstancesTracker()
+	containerGroup := newTestContainerGroup("default-web", "web:1")
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 1, 0, 0)
+	creating := []saladclient.ContainerGroupInstance{newTestInstance("a", saladclient.CONTAINERGROUPINSTANCESTATE_CREATING)}
+	now := time.Now()
+	assert.True(t, tracker.changed(&containerGroup, creating))
+	tracker.observe(&containerGroup, creating, nil, now)
+	snapshot, ok := tracker.cached(&containerGroup, now)
+	assert.True(t, ok)
+	assert.Len(t, snapshot.instances, 1)
+	_, ok = tracker.cached(&containerGroup, now.Add(instancesRefreshInterval))
+	assert.False(t, ok)
+
+	// A change of state lists the instances again
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 0, 1, 0)
+	_, ok = tracker.cached(&containerGroup, now)
+	assert.False(t, ok)
+
+	// Along with the workload errors when the instances changed
+	running := []saladclient.ContainerGroupInstance{newTestInstance("a", saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING)}
+	assert.True(t, tracker.changed(&containerGroup, running))
+	workloadErrors := []saladclient.WorkloadError{newTestWorkloadError("a", "Container exited with code 1", now)}
+	tracker.observe(&containerGroup, running, workloadErrors, now)
+	assert.False(t, tracker.changed(&containerGroup, running))
+
+	// Unchanged instances are listed again less and less often
+	for _, interval := range []time.Duration{2 * instancesRefreshInterval, 4 * instancesRefreshInterval, 8 * instancesRefreshInterval, maxInstancesRefreshInterval, maxInstancesRefreshInterval} {
+		snapshot = tracker.observe(&containerGroup, running, nil, now)
+		_, ok = tracker.cached(&containerGroup, now.Add(interval-time.Second))
+		assert.True(t, ok)
+		_, ok = tracker.cached(&containerGroup, now.Add(interval))
+		assert.False(t, ok)
+	}
+	// The workload errors are kept when they were not listed
+	assert.Len(t, snapshot.workloadErrors, 1)
+
+	// Until they change
+	instance := newTestInstance("a", saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING)
+	ready := true
+	instance.Ready = &ready
+	tracker.observe(&containerGroup, []saladclient.ContainerGroupInstance{instance}, nil, now)
+	_, ok = tracker.cached(&containerGroup, now.Add(instancesRefreshInterval))
+	assert.False(t, ok)
+
+	tracker.forget(containerGroup.Name)
+	_, ok = tracker.stale(containerGroup.Name)
+	assert.False(t, ok)
+}
+
+func Test_GetPodStatus_instances(t *testing.T) {
+	name := utils.GetContainerGroupName("default", "web")
+	containerGroup := newTestContainerGroup(name, "web:1")
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 1, 0, 0)
+	instance := newTestInstance("a", saladclient.CONTAINERGROUPINSTANCESTATE_DOWNLOADING)
+	workloadErrors := []saladclient.WorkloadError{}
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/instances"):
+			_ = json.NewEncoder(w).Encode(saladclient.NewContainerGroupInstanceCollection([]saladclient.ContainerGroupInstance{instance}))
+		case strings.HasSuffix(r.URL.Path, "/errors"):
+			_ = json.NewEncoder(w).Encode(saladclient.NewWorkloadErrorList(workloadErrors))
+		default:
+			_ = json.NewEncoder(w).Encode(containerGroup)
+		}
+	}))
+
+	status, err := p.GetPodStatus(context.Background(), "default", "web")
+	require.NoError(t, err)
+	require.Len(t, status.ContainerStatuses, 1)
+	waiting := status.ContainerStatuses[0].State.Waiting
+	require.NotNil(t, waiting)
+	assert.Equal(t, "Downloading", waiting.Reason)
+	assert.Contains(t, waiting.Message, "machine-a")
+	assert.Equal(t, corev1.PodPending, status.Phase)
+	conditions := make(map[corev1.PodConditionType]corev1.ConditionStatus)
+	for _, condition := range status.Conditions {
+		conditions[condition.Type] = condition.Status
+	}
+	assert.Equal(t, corev1.ConditionTrue, conditions[podConditionInstanceAllocated])
+	assert.Equal(t, corev1.ConditionFalse, conditions[podConditionInstanceRunning])
+	assert.Equal(t, corev1.ConditionFalse, conditions[corev1.PodReady])
+
+	// Once running, every failure of the instance reported by SaladCloud counts as a restart
+	instance.State = saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 0, 1, 0)
+	status, err = p.GetPodStatus(context.Background(), "default", "web")
+	require.NoError(t, err)
+	assert.NotNil(t, status.ContainerStatuses[0].State.Running)
+	assert.Equal(t, int32(0), status.ContainerStatuses[0].RestartCount)
+	instance.State = saladclient.CONTAINERGROUPINSTANCESTATE_CREATING
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 1, 0, 0)
+	workloadErrors = append(workloadErrors, newTestWorkloadError("a", "Container exited with code 1", time.Now()))
+	p.podLister = newTestPodLister(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	})
+	status, err = p.GetPodStatus(context.Background(), "default", "web")
+	require.NoError(t, err)
+	// The pod that ran never goes back to Pending, it is only not ready
+	assert.Equal(t, corev1.PodRunning, status.Phase)
+	ready, _ := getPodCondition(status.Conditions, corev1.PodReady)
+	assert.Equal(t, corev1.ConditionFalse, ready.Status)
+	assert.Equal(t, int32(1), status.ContainerStatuses[0].RestartCount)
+	assert.Equal(t, "CrashLoopBackOff", status.ContainerStatuses[0].State.Waiting.Reason)
+	require.NotNil(t, status.ContainerStatuses[0].LastTerminationState.Terminated)
+	assert.Equal(t, int32(1), status.ContainerStatuses[0].LastTerminationState.Terminated.ExitCode)
+}
@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reason and message of pods running past their activeDeadlineSeconds, as the kubelet reports them
+const (
+	deadlineExceededReason  = "DeadlineExceeded"
+	deadlineExceededMessage = "Pod was active on the node longer than the specified deadline"
+)
+
+// isRunToCompletion reports whether the pod is meant to finish, as the pods of Jobs, rather than run
+// until it is deleted
+func isRunToCompletion(pod *corev1.Pod) bool {
+	return pod.Spec.RestartPolicy == corev1.RestartPolicyNever || pod.Spec.RestartPolicy == corev1.RestartPolicyOnFailure
+}
+
+// getListedPod returns the pod from the lister, nil when it is unknown
+func (p *SaladCloudProvider) getListedPod(namespace, name string) *corev1.Pod {
+	if p.podLister == nil {
+		return nil
+	}
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil
+	}
+	return pod
+}
+
+// setJobStatus enforces the active deadline of the pod and reports pods that run to completion as
+// Succeeded or Failed according to how their container exited
+func (p *SaladCloudProvider) setJobStatus(ctx context.Context, pod *corev1.Pod, containerGroup *saladclient.ContainerGroup, status *corev1.PodStatus) {
+	if pod == nil {
+		return
+	}
+	if p.enforceActiveDeadline(ctx, pod, containerGroup, status) {
+		return
+	}
+	if isRunToCompletion(pod) && containerGroup.CurrentState.Status == saladclient.CONTAINERGROUPSTATUS_STOPPED {
+		p.setStoppedJobStatus(ctx, pod, containerGroup, status)
+	}
+}
+
+// getActiveDeadline returns when the pod runs out of its activeDeadlineSeconds
+func getActiveDeadline(pod *corev1.Pod, containerGroup *saladclient.ContainerGroup) (time.Time, bool) {
+	if pod.Spec.ActiveDeadlineSeconds == nil {
+		return time.Time{}, false
+	}
+	start := containerGroup.CreateTime
+	if pod.Status.StartTime != nil {
+		start = pod.Status.StartTime.Time
+	}
+	return start.Add(time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second), true
+}
+
+// enforceActiveDeadline stops the container group of a pod running past its active deadline and
+// fails the pod. It reports whether the pod ran out of time.
+func (p *SaladCloudProvider) enforceActiveDeadline(ctx context.Context, pod *corev1.Pod, containerGroup *saladclient.ContainerGroup, status *corev1.PodStatus) bool {
+	deadline, ok := getActiveDeadline(pod, containerGroup)
+	if !ok || time.Now().Before(deadline) {
+		return false
+	}
+	switch containerGroup.CurrentState.Status {
+	case saladclient.CONTAINERGROUPSTATUS_SUCCEEDED, saladclient.CONTAINERGROUPSTATUS_FAILED:
+		// Finished on its own, whenever that was
+		return false
+	case saladclient.CONTAINERGROUPSTATUS_STOPPED:
+		if containerGroup.CurrentState.FinishTime.Before(deadline) {
+			return false
+		}
+	default:
+		// Stopping takes a while, the container group is only stopped once
+		if p.lifecycle.isStopping(containerGroup.Name) {
+			break
+		}
+		if err := p.stopContainerGroup(ctx, containerGroup.Name); err != nil {
+			p.logger.WithError(err).Errorf("enforceActiveDeadline: failed to stop container group %s", containerGroup.Name)
+			return false
+		}
+		p.lifecycle.stopping(containerGroup.Name)
+		p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupStopped, "Stopped container group %s: pod exceeded its active deadline of %ds", containerGroup.Name, *pod.Spec.ActiveDeadlineSeconds)
+	}
+
+	now := metav1.NewTime(time.Now())
+	status.Phase = corev1.PodFailed
+	status.Reason = deadlineExceededReason
+	status.Message = deadlineExceededMessage
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == corev1.PodReady || status.Conditions[i].Type == corev1.ContainersReady {
+			status.Conditions[i].Status = corev1.ConditionFalse
+		}
+	}
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		if isIgnoredContainerStatus(*containerStatus) {
+			continue
+		}
+		containerStatus.Ready = false
+		if containerStatus.State.Terminated != nil {
+			continue
+		}
+		terminated := &corev1.ContainerStateTerminated{
+			ExitCode:   137,
+			Reason:     deadlineExceededReason,
+			Message:    deadlineExceededMessage,
+			FinishedAt: now,
+		}
+		if containerStatus.State.Running != nil {
+			terminated.StartedAt = containerStatus.State.Running.StartedAt
+		}
+		containerStatus.State = corev1.ContainerState{Terminated: terminated}
+	}
+	return true
+}
+
+// setStoppedJobStatus fails a pod whose container group stopped after its container failed,
+// SaladCloud reports such container groups as stopped whatever the exit code
+func (p *SaladCloudProvider) setStoppedJobStatus(ctx context.Context, pod *corev1.Pod, containerGroup *saladclient.ContainerGroup, status *corev1.PodStatus) {
+	snapshot, err := p.getContainerGroupInstances(ctx, containerGroup)
+	if err != nil {
+		p.logger.WithError(err).Errorf("setStoppedJobStatus: failed to list workload errors of %s", containerGroup.Name)
+		return
+	}
+	terminations := getPodTerminations(snapshot.workloadErrors, nil, nil)
+	if len(terminations) == 0 {
+		return
+	}
+	last := terminations[len(terminations)-1]
+	if last.FailedAt.Before(containerGroup.CurrentState.StartTime) {
+		// A failure of an earlier run
+		return
+	}
+	terminated := getTerminatedState(last)
+	status.Phase = corev1.PodFailed
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		if isIgnoredContainerStatus(*containerStatus) {
+			continue
+		}
+		containerStatus.Ready = false
+		containerStatus.RestartCount = int32(len(terminations) - 1)
+		containerStatus.State = corev1.ContainerState{Terminated: terminated}
+		if len(terminations) > 1 {
+			containerStatus.LastTerminationState = corev1.ContainerState{Terminated: getTerminatedState(terminations[len(terminations)-2])}
+		}
+	}
+}
+
+// stopContainerGroup stops the instances of a container group and keeps the container group
+func (p *SaladCloudProvider) stopContainerGroup(ctx context.Context, containerGroupName string) error {
+	stopCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	r, err := p.apiClient.ContainerGroupsAPI.StopContainerGroup(stopCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroupName).Execute()
+	if err != nil {
+		return models.NewSaladCloudError(err, r)
+	}
+	return nil
+}
+
+// isFinishedContainerGroupExpired reports whether the container group of a finished pod has been
+// kept for the TTL, zero keeps them until the pods are deleted
+func isFinishedContainerGroupExpired(clusterPod *corev1.Pod, providerPod *corev1.Pod, ttl time.Duration, now time.Time) bool {
+	if ttl <= 0 || (clusterPod.Status.Phase != corev1.PodSucceeded && clusterPod.Status.Phase != corev1.PodFailed) {
+		return false
+	}
+	if providerPod.Labels[ownerReplicaSetLabel] != "" || len(providerPod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	terminated := providerPod.Status.ContainerStatuses[0].State.Terminated
+	if terminated == nil {
+		// Still running, such as when stopping it failed
+		return false
+	}
+	return now.Sub(terminated.FinishedAt.Time) >= ttl
+}
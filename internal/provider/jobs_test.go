@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newJobPod(activeDeadlineSeconds *int64, startTime time.Time) *corev1.Pod {
+	start := metav1.NewTime(startTime)
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "job"},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: activeDeadlineSeconds,
+			Containers:            []corev1.Container{{Name: "job", Image: "job:1"}},
+		},
+		Status: corev1.PodStatus{StartTime: &start},
+	}
+}
+
+func Test_enforceActiveDeadline(t *testing.T) {
+	var stopped []string
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/stop") {
+			stopped = append(stopped, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(saladclient.ProblemDetails{})
+	}))
+	deadline := int64(60)
+	containerGroup := newTestContainerGroup("default-job", "job:1")
+
+	// Within its deadline, the pod runs on
+	pod := newJobPod(&deadline, time.Now())
+	status := p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, corev1.PodRunning, status.Phase)
+	assert.Empty(t, stopped)
+
+	// Past it, the container group is stopped and the pod fails
+	pod = newJobPod(&deadline, time.Now().Add(-time.Hour))
+	status = p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, []string{"/organizations/org/projects/project/containers/default-job/stop"}, stopped)
+	assert.Equal(t, corev1.PodFailed, status.Phase)
+	assert.Equal(t, deadlineExceededReason, status.Reason)
+	require.NotNil(t, status.ContainerStatuses[0].State.Terminated)
+	assert.Equal(t, deadlineExceededReason, status.ContainerStatuses[0].State.Terminated.Reason)
+
+	// While it stops, the container group is not stopped again
+	containerGroup.CurrentState.Status = saladclient.CONTAINERGROUPSTATUS_DEPLOYING
+	status = p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, corev1.PodFailed, status.Phase)
+	assert.Len(t, stopped, 1)
+
+	// The stopped container group keeps failing the pod without being stopped again
+	containerGroup.CurrentState.Status = saladclient.CONTAINERGROUPSTATUS_STOPPED
+	containerGroup.CurrentState.FinishTime = time.Now()
+	status = p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, corev1.PodFailed, status.Phase)
+	assert.Len(t, stopped, 1)
+}
+
+func Test_setStoppedJobStatus(t *testing.T) {
+	containerGroup := newTestContainerGroup("default-job", "job:1")
+	containerGroup.CurrentState.Status = saladclient.CONTAINERGROUPSTATUS_STOPPED
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 0, 0, 0)
+	containerGroup.CurrentState.StartTime = time.Now().Add(-time.Hour)
+	containerGroup.CurrentState.FinishTime = time.Now()
+	var workloadErrors []saladclient.WorkloadError
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/instances"):
+			_ = json.NewEncoder(w).Encode(saladclient.NewContainerGroupInstanceCollection([]saladclient.ContainerGroupInstance{}))
+		case strings.HasSuffix(r.URL.Path, "/errors"):
+			_ = json.NewEncoder(w).Encode(saladclient.NewWorkloadErrorList(workloadErrors))
+		}
+	}))
+	pod := newJobPod(nil, containerGroup.CreateTime)
+
+	// Stopped without failing, the job succeeded
+	status := p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, corev1.PodSucceeded, status.Phase)
+	require.NotNil(t, status.ContainerStatuses[0].State.Terminated)
+	assert.Equal(t, int32(0), status.ContainerStatuses[0].State.Terminated.ExitCode)
+
+	// Stopped after its container failed, it did not
+	workloadErrors = []saladclient.WorkloadError{newTestWorkloadError("a", "Container exited with code 2", time.Now().Add(-time.Minute))}
+	p.instances.forget(containerGroup.Name)
+	status = p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+	p.setJobStatus(context.Background(), pod, &containerGroup, status)
+	assert.Equal(t, corev1.PodFailed, status.Phase)
+	assert.Equal(t, int32(2), status.ContainerStatuses[0].State.Terminated.ExitCode)
+}
+
+func Test_isFinishedContainerGroupExpired(t *testing.T) {
+	now := time.Now()
+	providerPod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: metav1.NewTime(now.Add(-2 * time.Hour))}},
+	}}}}
+	succeeded := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}}
+	running := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+
+	assert.True(t, isFinishedContainerGroupExpired(succeeded, providerPod, time.Hour, now))
+	assert.False(t, isFinishedContainerGroupExpired(succeeded, providerPod, 3*time.Hour, now))
+	assert.False(t, isFinishedContainerGroupExpired(succeeded, providerPod, 0, now))
+	assert.False(t, isFinishedContainerGroupExpired(running, providerPod, time.Hour, now))
+}
@@ -0,0 +1,243 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	nodeapi "github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+const (
+	// How far back to look for logs when the caller sets no since time
+	defaultLogsLookback = 24 * time.Hour
+	logEntriesPageSize  = 1000
+)
+
+// How often to poll for new log entries when following logs
+var logsFollowInterval = 5 * time.Second
+
+// The log entries API is not part of the generated SaladCloud client yet, so the request and
+// response bodies are declared here.
+type logEntriesQuery struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Query     string    `json:"query"`
+	PageSize  int       `json:"page_size"`
+	SortOrder string    `json:"sort_order"`
+}
+
+type logEntry struct {
+	EventTime          time.Time `json:"event_time"`
+	Message            string    `json:"message"`
+	ContainerGroupName string    `json:"container_group_name"`
+	InstanceID         string    `json:"instance_id"`
+	MachineID          string    `json:"machine_id"`
+}
+
+type logEntryList struct {
+	Items []logEntry `json:"items"`
+}
+
+// GetContainerLogs returns the logs of the container group of the pod. The container name is not
+// used: a container group runs the main container of the pod only, whose logs are returned for
+// any container of the pod.
+func (p *SaladCloudProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts nodeapi.ContainerLogOpts) (io.ReadCloser, error) {
+	// Pods sharing the container group of their ReplicaSet get the logs of all its instances
+	containerGroupName := p.getContainerGroupNameOf(namespace, podName, p.getReplicaSetOwnerOf(namespace, podName))
+	now := time.Now().UTC()
+	since := now.Add(-defaultLogsLookback)
+	if !opts.SinceTime.IsZero() {
+		since = opts.SinceTime
+	} else if opts.SinceSeconds > 0 {
+		since = now.Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	}
+
+	// The newest entries, so that the tail is right when there are more than a page of them
+	entries, err := p.queryLogEntries(ctx, containerGroupName, since, now, "desc")
+	if err != nil {
+		p.logger.WithError(err).Errorf("GetContainerLogs: failed to query logs for %s", containerGroupName)
+		return nil, err
+	}
+	cursor := &logsCursor{last: since}
+	cursor.advance(entries)
+	if opts.Tail > 0 && len(entries) > opts.Tail {
+		entries = entries[len(entries)-opts.Tail:]
+	}
+
+	writer := &logsWriter{limitBytes: opts.LimitBytes, timestamps: opts.Timestamps}
+	writer.write(entries)
+	if !opts.Follow || writer.full() {
+		return io.NopCloser(&writer.buffer), nil
+	}
+
+	// Keep polling for new entries until the caller goes away
+	reader, pipe := io.Pipe()
+	go func() {
+		defer pipe.Close()
+		if _, err := writer.flush(pipe); err != nil {
+			return
+		}
+		ticker := time.NewTicker(logsFollowInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Entries sharing the last timestamp may arrive over several polls
+				entries, err := p.queryLogEntries(ctx, containerGroupName, cursor.last, time.Now().UTC(), "asc")
+				if err != nil {
+					p.logger.WithError(err).Warnf("GetContainerLogs: failed to follow logs for %s", containerGroupName)
+					continue
+				}
+				entries = cursor.advance(entries)
+				if len(entries) == 0 {
+					continue
+				}
+				writer.write(entries)
+				if _, err := writer.flush(pipe); err != nil || writer.full() {
+					return
+				}
+			}
+		}
+	}()
+	return reader, nil
+}
+
+// queryLogEntries returns a page of the log entries of every instance of a container group in
+// ascending time order. The sort order picks whether the page holds the oldest or the newest ones.
+func (p *SaladCloudProvider) queryLogEntries(ctx context.Context, containerGroupName string, start, end time.Time, sortOrder string) ([]logEntry, error) {
+	ctx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	cfg := p.apiClient.GetConfig()
+	baseURL, err := cfg.Servers.URL(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(logEntriesQuery{
+		StartTime: start,
+		EndTime:   end,
+		Query:     fmt.Sprintf("project_name = %q AND container_group_name = %q", p.inputVars.ProjectName, containerGroupName),
+		PageSize:  logEntriesPageSize,
+		SortOrder: sortOrder,
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/organizations/%s/log-entries", baseURL, url.PathEscape(p.inputVars.OrganizationName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Salad-Api-Key", p.inputVars.ApiKey)
+	req.Header.Set("User-Agent", cfg.UserAgent)
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		pd, err := utils.GetResponseBody(response)
+		if err != nil {
+			return nil, err
+		}
+		return nil, models.NewSaladCloudError(fmt.Errorf("%s: %s", pd.GetTitle(), pd.GetDetail()), response)
+	}
+
+	var list logEntryList
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	if sortOrder == "desc" {
+		slices.Reverse(list.Items)
+	}
+	return list.Items, nil
+}
+
+// logsCursor remembers the last timestamp written when following logs and the entries written at
+// it, so that entries are neither dropped nor written twice
+type logsCursor struct {
+	last time.Time
+	seen map[string]bool
+}
+
+// advance returns the entries, in ascending time order, that were not written yet. Entries are
+// told apart by their instance, their message and how many identical ones came before them at
+// the same timestamp, so that repeated lines are all written.
+func (c *logsCursor) advance(entries []logEntry) []logEntry {
+	fresh := make([]logEntry, 0, len(entries))
+	occurrences := make(map[string]int)
+	for _, entry := range entries {
+		identity := fmt.Sprintf("%d/%s/%s", entry.EventTime.UnixNano(), entry.InstanceID, entry.Message)
+		key := fmt.Sprintf("%s/%d", identity, occurrences[identity])
+		occurrences[identity]++
+		switch {
+		case entry.EventTime.Before(c.last):
+			continue
+		case entry.EventTime.Equal(c.last):
+			if c.seen[key] {
+				continue
+			}
+		default:
+			c.last = entry.EventTime
+			c.seen = nil
+		}
+		if c.seen == nil {
+			c.seen = make(map[string]bool)
+		}
+		c.seen[key] = true
+		fresh = append(fresh, entry)
+	}
+	return fresh
+}
+
+// logsWriter formats log entries the way kubectl expects them, honoring the byte limit
+type logsWriter struct {
+	buffer     bytes.Buffer
+	limitBytes int
+	written    int
+	timestamps bool
+}
+
+func (w *logsWriter) write(entries []logEntry) {
+	for _, entry := range entries {
+		line := fmt.Sprintf("[%s] %s", entry.InstanceID, strings.TrimRight(entry.Message, "\n"))
+		if w.timestamps {
+			line = entry.EventTime.UTC().Format(time.RFC3339Nano) + " " + line
+		}
+		line += "\n"
+		if w.limitBytes > 0 && w.written+len(line) > w.limitBytes {
+			line = line[:w.limitBytes-w.written]
+		}
+		w.buffer.WriteString(line)
+		w.written += len(line)
+		if w.full() {
+			return
+		}
+	}
+}
+
+func (w *logsWriter) flush(out io.Writer) (int64, error) {
+	return w.buffer.WriteTo(out)
+}
+
+func (w *logsWriter) full() bool {
+	return w.limitBytes > 0 && w.written >= w.limitBytes
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	nodeapi "github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+// newTestServerProvider returns a provider whose SaladCloud API client talks to the given handler
+func newTestServerProvider(t *testing.T, handler http.Handler) *SaladCloudProvider {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	p, err := newProvider()
+	require.NoError(t, err)
+	p.inputVars.OrganizationName = "org"
+	p.inputVars.ProjectName = "project"
+	// Keep the API transport of the provider
+	p.apiClient.GetConfig().Servers = saladclient.ServerConfigurations{{URL: server.URL}}
+	return p
+}
+
+func Test_GetContainerLogs(t *testing.T) {
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	var queries []logEntriesQuery
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/organizations/org/log-entries", r.URL.Path)
+		var query logEntriesQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		queries = append(queries, query)
+		items := []logEntry{
+			{EventTime: base, Message: "first\n", InstanceID: "a"},
+			{EventTime: base.Add(time.Second), Message: "second", InstanceID: "b"},
+			{EventTime: base.Add(2 * time.Second), Message: "third", InstanceID: "a"},
+		}
+		if query.SortOrder == "desc" {
+			slices.Reverse(items)
+		}
+		_ = json.NewEncoder(w).Encode(logEntryList{Items: items})
+	}))
+
+	readAll := func(opts nodeapi.ContainerLogOpts) string {
+		reader, err := p.GetContainerLogs(context.Background(), "default", "web", "web", opts)
+		require.NoError(t, err)
+		defer reader.Close()
+		out, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	assert.Equal(t, "[a] first\n[b] second\n[a] third\n", readAll(nodeapi.ContainerLogOpts{}))
+	assert.Contains(t, queries[0].Query, strconv.Quote(utils.GetContainerGroupName("default", "web")))
+	// The newest entries come first, so that a page holds the tail
+	assert.Equal(t, "desc", queries[0].SortOrder)
+
+	assert.Equal(t, "[b] second\n[a] third\n", readAll(nodeapi.ContainerLogOpts{Tail: 2}))
+	assert.Equal(t, "[a] fi", readAll(nodeapi.ContainerLogOpts{LimitBytes: 6}))
+	assert.Equal(t, "2025-01-02T03:04:07Z [a] third\n", readAll(nodeapi.ContainerLogOpts{Tail: 1, Timestamps: true}))
+
+	readAll(nodeapi.ContainerLogOpts{SinceTime: base})
+	assert.True(t, queries[len(queries)-1].StartTime.Equal(base))
+}
+
+func Test_GetContainerLogs_Follow(t *testing.T) {
+	defer func(interval time.Duration) { logsFollowInterval = interval }(logsFollowInterval)
+	logsFollowInterval = 10 * time.Millisecond
+
+	base := time.Now().UTC()
+	var queries []logEntriesQuery
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query logEntriesQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		queries = append(queries, query)
+		// Entries sharing a timestamp show up over several polls
+		items := [][]logEntry{
+			{{EventTime: base, Message: "started", InstanceID: "a"}},
+			{{EventTime: base, Message: "started", InstanceID: "a"}, {EventTime: base.Add(time.Second), Message: "one", InstanceID: "a"}},
+			{{EventTime: base.Add(time.Second), Message: "one", InstanceID: "a"}, {EventTime: base.Add(time.Second), Message: "two", InstanceID: "b"}},
+		}[min(len(queries), 3)-1]
+		_ = json.NewEncoder(w).Encode(logEntryList{Items: items})
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := p.GetContainerLogs(ctx, "default", "web", "web", nodeapi.ContainerLogOpts{Follow: true, LimitBytes: 28})
+	require.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "[a] started\n[a] one\n[b] two\n", string(out))
+	assert.True(t, queries[2].StartTime.Equal(base.Add(time.Second)))
+}
+
+func Test_logsCursor(t *testing.T) {
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	cursor := &logsCursor{last: base}
+	entries := []logEntry{
+		{EventTime: base, Message: "tick", InstanceID: "a"},
+		{EventTime: base, Message: "tick", InstanceID: "a"},
+	}
+	// Identical lines at the same timestamp are all written
+	assert.Len(t, cursor.advance(entries), 2)
+
+	// Once, even though the next query starts at the same timestamp
+	entries = append(entries, logEntry{EventTime: base, Message: "tick", InstanceID: "a"}, logEntry{EventTime: base.Add(time.Second), Message: "tock", InstanceID: "a"})
+	fresh := cursor.advance(entries)
+	require.Len(t, fresh, 2)
+	assert.Equal(t, "tick", fresh[0].Message)
+	assert.Equal(t, "tock", fresh[1].Message)
+	assert.Empty(t, cursor.advance(entries[3:]))
+}
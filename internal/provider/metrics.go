@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const metricsNamespace = "saladcloud_vk"
+
+// Registry of the metrics about the provider itself, served apart from the pod metrics of the kubelet API
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	apiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_requests_total",
+		Help:      "SaladCloud API requests by operation and HTTP status code, every attempt counted",
+	}, []string{"operation", "code"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of single SaladCloud API request attempts by operation",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+	apiRateLimitWaitDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_rate_limit_wait_seconds",
+		Help:      "Time SaladCloud API requests waited for the client side rate limiter",
+		Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10},
+	})
+	podsByPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods",
+		Help:      "Pods scheduled on the node by phase",
+	}, []string{"phase"})
+	podsTrackerLoopDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods_tracker_loop_duration_seconds",
+		Help:      "Duration of the pod status update and stale pod cleanup loops",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"loop"})
+	stalePodDeletionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "stale_pod_deletions_total",
+		Help:      "Container groups of stale pods deleted by the cleanup loop by result",
+	}, []string{"result"})
+	createPodFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "create_pod_failures_total",
+		Help:      "Failed container group creations by SaladCloud problem type",
+	}, []string{"type"})
+)
+
+// Label of failures without a SaladCloud problem, such as network errors and throttling
+const transientProblemType = "transient"
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		apiRequestsTotal,
+		apiRequestDuration,
+		apiRateLimitWaitDuration,
+		podsByPhase,
+		podsTrackerLoopDuration,
+		stalePodDeletionsTotal,
+		createPodFailuresTotal,
+	)
+}
+
+// MetricsHandler serves the metrics of the provider in the Prometheus format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{Registry: metricsRegistry})
+}
+
+// getAPIOperation names a SaladCloud API call after its method and path, with the organization,
+// project, container group and instance names left out to keep the label cardinality bounded
+func getAPIOperation(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	// Skip the base path of the API server
+	for i, segment := range segments {
+		if segment == "organizations" {
+			segments = segments[i:]
+			break
+		}
+	}
+	for i := 1; i < len(segments); i += 2 {
+		// Paths alternate between collections and the names of their items
+		segments[i] = "{" + strings.TrimSuffix(segments[i-1], "s") + "}"
+	}
+	return req.Method + " /" + strings.Join(segments, "/")
+}
+
+func getStatusCodeLabel(response *http.Response, err error) string {
+	if err != nil || response == nil {
+		return "error"
+	}
+	return strconv.Itoa(response.StatusCode)
+}
+
+// setPodsByPhase replaces the pod counts with those of the given pods
+func setPodsByPhase(pods []*corev1.Pod) {
+	counts := map[corev1.PodPhase]int{
+		corev1.PodPending:   0,
+		corev1.PodRunning:   0,
+		corev1.PodSucceeded: 0,
+		corev1.PodFailed:    0,
+		corev1.PodUnknown:   0,
+	}
+	for _, pod := range pods {
+		phase := pod.Status.Phase
+		if phase == "" {
+			phase = corev1.PodPending
+		}
+		counts[phase]++
+	}
+	for phase, count := range counts {
+		podsByPhase.WithLabelValues(string(phase)).Set(float64(count))
+	}
+}
+
+func recordCreatePodFailure(problemType string) {
+	if problemType == "" {
+		problemType = "unknown"
+	}
+	createPodFailuresTotal.WithLabelValues(problemType).Inc()
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_getAPIOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   string
+	}{
+		{http.MethodGet, "https://api.salad.com/api/public/organizations/org/projects/project/containers",
+			"GET /organizations/{organization}/projects/{project}/containers"},
+		{http.MethodPatch, "https://api.salad.com/api/public/organizations/org/projects/project/containers/default-web-1a2b3c4d",
+			"PATCH /organizations/{organization}/projects/{project}/containers/{container}"},
+		{http.MethodPost, "https://api.salad.com/api/public/organizations/org/log-entries",
+			"POST /organizations/{organization}/log-entries"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, getAPIOperation(req))
+	}
+}
+
+func Test_apiTransport_metrics(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	operation := "GET /organizations/{organization}/gpu-classes"
+	failed := testutil.ToFloat64(apiRequestsTotal.WithLabelValues(operation, "503"))
+	succeeded := testutil.ToFloat64(apiRequestsTotal.WithLabelValues(operation, "200"))
+	calls := 0
+	transport := newAPITransport(newStatusTransport(&calls, nil, http.StatusServiceUnavailable, http.StatusOK),
+		models.InputVars{APIMaxRetries: 1}, newCircuitBreaker(0, 0), log.G(context.Background()))
+
+	req, err := http.NewRequest(http.MethodGet, "https://api.salad.com/api/public/organizations/org/gpu-classes", nil)
+	require.NoError(t, err)
+	response, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	// Every attempt is counted
+	assert.Equal(t, failed+1, testutil.ToFloat64(apiRequestsTotal.WithLabelValues(operation, "503")))
+	assert.Equal(t, succeeded+1, testutil.ToFloat64(apiRequestsTotal.WithLabelValues(operation, "200")))
+}
+
+func Test_setPodsByPhase(t *testing.T) {
+	setPodsByPhase([]*corev1.Pod{
+		{Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		{Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		{},
+	})
+	assert.Equal(t, 2.0, testutil.ToFloat64(podsByPhase.WithLabelValues(string(corev1.PodRunning))))
+	assert.Equal(t, 1.0, testutil.ToFloat64(podsByPhase.WithLabelValues(string(corev1.PodPending))))
+	assert.Equal(t, 0.0, testutil.ToFloat64(podsByPhase.WithLabelValues(string(corev1.PodFailed))))
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+)
+
+// legacyNamesTracker remembers the pods whose container groups were created with the
+// namespace-name naming used before container group names were hashed, so that these container
+// groups keep being used and cleaned up instead of being duplicated under the new name
+type legacyNamesTracker struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newLegacyNamesTracker() *legacyNamesTracker {
+	return &legacyNamesTracker{names: make(map[string]string)}
+}
+
+func (lt *legacyNamesTracker) get(namespace, name string) (string, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	containerGroupName, ok := lt.names[getPodKey(namespace, name)]
+	return containerGroupName, ok
+}
+
+// observe remembers the container group when it carries the legacy name of the pod it was created for
+func (lt *legacyNamesTracker) observe(containerGroup saladclient.ContainerGroup) bool {
+	env := containerGroup.Container.EnvironmentVariables
+	namespace, name := env[ownerPodNamespaceEnvVar], env[ownerPodNameEnvVar]
+	if _, ok := getContainerGroupPodKey(containerGroup); !ok || containerGroup.Name != utils.GetLegacyContainerGroupName(namespace, name) {
+		return false
+	}
+	if containerGroup.Name == utils.GetContainerGroupName(namespace, name) {
+		return false
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.names[getPodKey(namespace, name)] = containerGroup.Name
+	return true
+}
+
+func (lt *legacyNamesTracker) forget(namespace, name string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.names, getPodKey(namespace, name))
+}
+
+// getLegacyContainerGroup looks the container group of the pod up by its legacy name, for pods
+// that were created before container group names were hashed and were not listed yet
+func (p *SaladCloudProvider) getLegacyContainerGroup(ctx context.Context, namespace, name string) (*saladclient.ContainerGroup, bool) {
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	containerGroup, _, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, utils.GetLegacyContainerGroupName(namespace, name)).Execute()
+	if err != nil {
+		return nil, false
+	}
+	if key, ok := getContainerGroupPodKey(*containerGroup); !ok || key != getPodKey(namespace, name) {
+		return nil, false
+	}
+	if !p.legacyNames.observe(*containerGroup) {
+		return nil, false
+	}
+	p.logger.Infof("Using container group %s named before container group names were hashed for pod %s/%s", containerGroup.Name, namespace, name)
+	return containerGroup, true
+}
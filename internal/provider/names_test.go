@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GetPod_legacyName(t *testing.T) {
+	legacy := newTestContainerGroup("default-web", "web:1")
+	legacy.Container.EnvironmentVariables = map[string]string{
+		ownerNodeNameEnvVar:     "saladcloud-node",
+		ownerPodNamespaceEnvVar: "default",
+		ownerPodNameEnvVar:      "web",
+	}
+	other := newTestContainerGroup("default-other", "other:1")
+	var deleted []string
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, name)
+			w.WriteHeader(http.StatusAccepted)
+		case name == legacy.Name:
+			_ = json.NewEncoder(w).Encode(legacy)
+		case name == other.Name:
+			_ = json.NewEncoder(w).Encode(other)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(saladclient.ProblemDetails{})
+		}
+	}))
+	assert.Equal(t, utils.GetContainerGroupName("default", "web"), p.getContainerGroupNameOf("default", "web", nil))
+
+	// The container group named before names were hashed is found and kept
+	pod, err := p.GetPod(context.Background(), "default", "web")
+	require.NoError(t, err)
+	require.NotNil(t, pod)
+	assert.Equal(t, "default-web", pod.Spec.Containers[0].Name)
+	assert.Equal(t, "default-web", p.getContainerGroupNameOf("default", "web", nil))
+	require.NoError(t, p.DeletePod(context.Background(), pod))
+	assert.Equal(t, []string{"default-web"}, deleted)
+	assert.Equal(t, utils.GetContainerGroupName("default", "web"), p.getContainerGroupNameOf("default", "web", nil))
+
+	// But never one without the metadata of the pod
+	pod, err = p.GetPod(context.Background(), "default", "other")
+	assert.NoError(t, err)
+	assert.Nil(t, pod)
+	assert.Equal(t, utils.GetContainerGroupName("default", "other"), p.getContainerGroupNameOf("default", "other", nil))
+}
+
+func Test_legacyNamesTracker(t *testing.T) {
+	tracker := newLegacyNamesTracker()
+	containerGroup := newTestContainerGroup("default-web", "web:1")
+	containerGroup.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerPodNameEnvVar: "web"}
+	assert.True(t, tracker.observe(containerGroup))
+	name, ok := tracker.get("default", "web")
+	assert.True(t, ok)
+	assert.Equal(t, "default-web", name)
+
+	// Container groups with the hashed name need no mapping
+	containerGroup.Name = utils.GetContainerGroupName("default", "api")
+	containerGroup.Container.EnvironmentVariables[ownerPodNameEnvVar] = "api"
+	assert.False(t, tracker.observe(containerGroup))
+	_, ok = tracker.get("default", "api")
+	assert.False(t, ok)
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Annotations overriding the container gateway derived from the container ports
+const (
+	networkingAnnotation                      = "salad.com/networking"
+	networkingProtocolAnnotation              = "salad.com/networking-protocol"
+	networkingPortAnnotation                  = "salad.com/networking-port"
+	networkingAuthAnnotation                  = "salad.com/networking-auth"
+	networkingLoadBalancerAnnotation          = "salad.com/networking-load-balancer"
+	networkingSingleConnectionLimitAnnotation = "salad.com/networking-single-connection-limit"
+	networkingClientRequestTimeoutAnnotation  = "salad.com/networking-client-request-timeout"
+	networkingServerResponseTimeoutAnnotation = "salad.com/networking-server-response-timeout"
+)
+
+// Bounds of the gateway timeouts accepted by SaladCloud
+const (
+	minNetworkingTimeout = time.Millisecond
+	maxNetworkingTimeout = 100 * time.Second
+)
+
+// Returned for networking annotations and ports that cannot make a container gateway
+var errInvalidNetworking = errors.New("invalid networking")
+
+var networkingAnnotations = []string{
+	networkingAnnotation,
+	networkingProtocolAnnotation,
+	networkingPortAnnotation,
+	networkingAuthAnnotation,
+	networkingLoadBalancerAnnotation,
+	networkingSingleConnectionLimitAnnotation,
+	networkingClientRequestTimeoutAnnotation,
+	networkingServerResponseTimeoutAnnotation,
+}
+
+// getNetworking returns the container gateway of the pod. SaladCloud exposes a single port, which
+// is the first TCP port of the container unless the port annotation names another one by number
+// or by name. Pods without ports nor networking annotations have no gateway, and the networking
+// annotation set to false turns it off. Authentication is required unless the auth annotation
+// turns it off.
+func (p *SaladCloudProvider) getNetworking(pod *corev1.Pod, container corev1.Container) (*saladclient.CreateContainerGroupNetworking, error) {
+	annotations := make(map[string]string)
+	for _, name := range networkingAnnotations {
+		if value, ok := pod.Annotations[name]; ok {
+			annotations[name] = strings.TrimSpace(value)
+		}
+	}
+	if len(annotations) == 0 && len(container.Ports) == 0 {
+		return nil, nil
+	}
+	if value, ok := annotations[networkingAnnotation]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not a boolean", errInvalidNetworking, networkingAnnotation, value)
+		}
+		if !enabled {
+			return nil, nil
+		}
+	}
+
+	port, err := getNetworkingPort(annotations[networkingPortAnnotation], container.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := saladclient.CONTAINERNETWORKINGPROTOCOL_HTTP
+	if value, ok := annotations[networkingProtocolAnnotation]; ok {
+		parsedProtocol, err := saladclient.NewContainerNetworkingProtocolFromValue(strings.ToLower(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not a supported protocol", errInvalidNetworking, networkingProtocolAnnotation, value)
+		}
+		protocol = *parsedProtocol
+	}
+
+	auth := true
+	if value, ok := annotations[networkingAuthAnnotation]; ok {
+		if auth, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not a boolean", errInvalidNetworking, networkingAuthAnnotation, value)
+		}
+	}
+
+	networking := saladclient.NewCreateContainerGroupNetworking(auth, port, protocol)
+	if value, ok := annotations[networkingLoadBalancerAnnotation]; ok {
+		loadBalancer, err := saladclient.NewContainerGroupNetworkingLoadBalancerFromValue(strings.ToLower(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not a supported load balancer", errInvalidNetworking, networkingLoadBalancerAnnotation, value)
+		}
+		networking.SetLoadBalancer(*loadBalancer)
+	}
+	if value, ok := annotations[networkingSingleConnectionLimitAnnotation]; ok {
+		singleConnectionLimit, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not a boolean", errInvalidNetworking, networkingSingleConnectionLimitAnnotation, value)
+		}
+		networking.SetSingleConnectionLimit(singleConnectionLimit)
+	}
+	if value, ok := annotations[networkingClientRequestTimeoutAnnotation]; ok {
+		timeout, err := parseNetworkingTimeout(networkingClientRequestTimeoutAnnotation, value)
+		if err != nil {
+			return nil, err
+		}
+		networking.SetClientRequestTimeout(timeout)
+	}
+	if value, ok := annotations[networkingServerResponseTimeoutAnnotation]; ok {
+		timeout, err := parseNetworkingTimeout(networkingServerResponseTimeoutAnnotation, value)
+		if err != nil {
+			return nil, err
+		}
+		networking.SetServerResponseTimeout(timeout)
+	}
+	return networking, nil
+}
+
+// hasNetworkingAnnotations reports whether the gateway of the pod was asked for explicitly rather
+// than derived from its container ports
+func hasNetworkingAnnotations(pod *corev1.Pod) bool {
+	for _, name := range networkingAnnotations {
+		if _, ok := pod.Annotations[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getNetworkingPort resolves the port annotation against the container ports
+func getNetworkingPort(annotation string, ports []corev1.ContainerPort) (int32, error) {
+	if annotation == "" {
+		for _, port := range ports {
+			if port.Protocol == "" || port.Protocol == corev1.ProtocolTCP {
+				return port.ContainerPort, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: the container has no TCP port and the pod has no %s annotation", errInvalidNetworking, networkingPortAnnotation)
+	}
+	if number, err := strconv.Atoi(annotation); err == nil {
+		if number < 1 || number > 65535 {
+			return 0, fmt.Errorf("%w: %s %d is out of range", errInvalidNetworking, networkingPortAnnotation, number)
+		}
+		return int32(number), nil
+	}
+	for _, port := range ports {
+		if port.Name == annotation {
+			return port.ContainerPort, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s %q is neither a port number nor the name of a container port", errInvalidNetworking, networkingPortAnnotation, annotation)
+}
+
+// parseNetworkingTimeout reads a gateway timeout given as a duration, such as "30s", or in milliseconds
+func parseNetworkingTimeout(annotation, value string) (int32, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		milliseconds, atoiErr := strconv.Atoi(value)
+		if atoiErr != nil {
+			return 0, fmt.Errorf("%w: %s %q is not a duration", errInvalidNetworking, annotation, value)
+		}
+		timeout = time.Duration(milliseconds) * time.Millisecond
+	}
+	if timeout < minNetworkingTimeout || timeout > maxNetworkingTimeout {
+		return 0, fmt.Errorf("%w: %s %s is not between %s and %s", errInvalidNetworking, annotation, timeout, minNetworkingTimeout, maxNetworkingTimeout)
+	}
+	return int32(timeout / time.Millisecond), nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_getNetworking(t *testing.T) {
+	p, _ := newProvider()
+	ports := []corev1.ContainerPort{
+		{Name: "metrics", ContainerPort: 9090, Protocol: corev1.ProtocolUDP},
+		{Name: "http", ContainerPort: 8080},
+		{Name: "admin", ContainerPort: 8081},
+	}
+	getNetworking := func(annotations map[string]string, ports []corev1.ContainerPort) (*saladclient.CreateContainerGroupNetworking, error) {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		return p.getNetworking(pod, corev1.Container{Ports: ports})
+	}
+
+	networking, err := getNetworking(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, networking)
+
+	// The first TCP port, behind authentication
+	networking, err = getNetworking(nil, ports)
+	require.NoError(t, err)
+	assert.Equal(t, int32(8080), networking.Port)
+	assert.True(t, networking.Auth)
+	assert.Equal(t, saladclient.CONTAINERNETWORKINGPROTOCOL_HTTP, networking.Protocol)
+
+	networking, err = getNetworking(map[string]string{
+		networkingPortAnnotation:                  "admin",
+		networkingAuthAnnotation:                  "false",
+		networkingLoadBalancerAnnotation:          "least_number_of_connections",
+		networkingSingleConnectionLimitAnnotation: "true",
+		networkingClientRequestTimeoutAnnotation:  "30s",
+		networkingServerResponseTimeoutAnnotation: "5000",
+	}, ports)
+	require.NoError(t, err)
+	assert.Equal(t, int32(8081), networking.Port)
+	assert.False(t, networking.Auth)
+	assert.Equal(t, saladclient.CONTAINERGROUPNETWORKINGLOADBALANCER_LEAST_NUMBER_OF_CONNECTIONS, networking.GetLoadBalancer())
+	assert.True(t, networking.GetSingleConnectionLimit())
+	assert.Equal(t, int32(30000), networking.GetClientRequestTimeout())
+	assert.Equal(t, int32(5000), networking.GetServerResponseTimeout())
+
+	// Unless it is turned off
+	networking, err = getNetworking(map[string]string{networkingAnnotation: "false"}, ports)
+	require.NoError(t, err)
+	assert.Nil(t, networking)
+
+	// The annotations alone still make a gateway
+	networking, err = getNetworking(map[string]string{networkingPortAnnotation: "80"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(80), networking.Port)
+
+	for name, annotations := range map[string]map[string]string{
+		"partial":        {networkingAuthAnnotation: "false"},
+		"bad port":       {networkingPortAnnotation: "eighty"},
+		"port range":     {networkingPortAnnotation: "70000"},
+		"bad protocol":   {networkingPortAnnotation: "80", networkingProtocolAnnotation: "ftp"},
+		"bad auth":       {networkingPortAnnotation: "80", networkingAuthAnnotation: "maybe"},
+		"bad balancer":   {networkingPortAnnotation: "80", networkingLoadBalancerAnnotation: "random"},
+		"long timeout":   {networkingPortAnnotation: "80", networkingClientRequestTimeoutAnnotation: "5m"},
+		"bad timeout":    {networkingPortAnnotation: "80", networkingServerResponseTimeoutAnnotation: "soon"},
+		"bad limit":      {networkingPortAnnotation: "80", networkingSingleConnectionLimitAnnotation: "1 please"},
+		"bad networking": {networkingAnnotation: "off"},
+		"unknown named":  {networkingPortAnnotation: "grpc"},
+	} {
+		_, err := getNetworking(annotations, nil)
+		assert.ErrorIs(t, err, errInvalidNetworking, name)
+	}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeProvider reports the node NotReady while the circuit breaker of the SaladCloud API is open,
+// so that no new pods are scheduled on a node that cannot create container groups. With capacity
+// from quotas it also keeps the node resources up to date.
+type NodeProvider struct {
+	mu       sync.Mutex
+	node     *corev1.Node
+	changed  chan struct{}
+	provider *SaladCloudProvider
+}
+
+// NewNodeProvider marks the node ready and keeps its Ready condition in sync with the API health
+func (p *SaladCloudProvider) NewNodeProvider(node *corev1.Node) *NodeProvider {
+	np := &NodeProvider{
+		node:     node,
+		changed:  make(chan struct{}, 1),
+		provider: p,
+	}
+	setNodeReadyCondition(node, !p.breaker.isOpen())
+	p.breaker.setOnChange(func(open bool) { np.setAPIAvailable(!open) })
+	return np
+}
+
+// Ping only checks the context, the API health is reported through the node status
+func (np *NodeProvider) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (np *NodeProvider) NotifyNodeStatus(ctx context.Context, cb func(*corev1.Node)) {
+	if inputVars := np.provider.inputVars; inputVars.CapacityFromQuotas && inputVars.QuotaRefreshInterval > 0 {
+		go np.refreshNodeResources(ctx, inputVars.QuotaRefreshInterval)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-np.changed:
+				np.mu.Lock()
+				node := np.node.DeepCopy()
+				np.mu.Unlock()
+				cb(node)
+			}
+		}
+	}()
+}
+
+func (np *NodeProvider) setAPIAvailable(available bool) {
+	np.mu.Lock()
+	setNodeReadyCondition(np.node, available)
+	np.mu.Unlock()
+	np.notify()
+}
+
+// notify signals a node status change. It never blocks, as a pending signal covers every change.
+func (np *NodeProvider) notify() {
+	select {
+	case np.changed <- struct{}{}:
+	default:
+	}
+}
+
+func setNodeReadyCondition(node *corev1.Node, ready bool) {
+	now := metav1.Now()
+	condition := corev1.NodeCondition{
+		Type:               corev1.NodeReady,
+		Status:             corev1.ConditionTrue,
+		Reason:             "KubeletReady",
+		Message:            "Kubelet is ready",
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+	}
+	if !ready {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "SaladCloudAPIUnavailable"
+		condition.Message = "The SaladCloud API is failing, the circuit breaker is open"
+	}
+
+	node.Status.Phase = corev1.NodeRunning
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type != corev1.NodeReady {
+			continue
+		}
+		if node.Status.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = node.Status.Conditions[i].LastTransitionTime
+		}
+		node.Status.Conditions[i] = condition
+		return
+	}
+	node.Status.Conditions = append(node.Status.Conditions, condition)
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func getNodeReadyStatus(t *testing.T, np *NodeProvider) corev1.ConditionStatus {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	for _, condition := range np.node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status
+		}
+	}
+	require.Fail(t, "node has no Ready condition")
+	return ""
+}
+
+func Test_NodeProvider_apiAvailability(t *testing.T) {
+	p, err := newProvider()
+	require.NoError(t, err)
+	p.breaker = newCircuitBreaker(1, 0)
+	np := p.NewNodeProvider(&corev1.Node{})
+	assert.Equal(t, corev1.ConditionTrue, getNodeReadyStatus(t, np))
+
+	calls := 0
+	transport := newAPITransport(newStatusTransport(&calls, nil, 500, 200), models.InputVars{}, p.breaker, log.G(context.Background()))
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+
+	// The node is NotReady while the breaker is open
+	_, _ = transport.RoundTrip(req)
+	require.True(t, p.breaker.isOpen())
+	assert.Equal(t, corev1.ConditionFalse, getNodeReadyStatus(t, np))
+
+	// And Ready again once a probe closes it
+	_, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	require.False(t, p.breaker.isOpen())
+	assert.Equal(t, corev1.ConditionTrue, getNodeReadyStatus(t, np))
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getOwnershipEnvironment returns the environment variables tagging a container group as created by this node
+func (p *SaladCloudProvider) getOwnershipEnvironment(pod *corev1.Pod) map[string]string {
+	if owner := p.getReplicaSetOwner(pod); owner != nil {
+		return map[string]string{
+			ownerNodeNameEnvVar:       p.inputVars.NodeName,
+			ownerClusterIDEnvVar:      p.inputVars.ClusterID,
+			ownerPodNamespaceEnvVar:   pod.Namespace,
+			ownerReplicaSetNameEnvVar: owner.Name,
+			ownerReplicaSetUIDEnvVar:  string(owner.UID),
+		}
+	}
+	return map[string]string{
+		ownerNodeNameEnvVar:     p.inputVars.NodeName,
+		ownerClusterIDEnvVar:    p.inputVars.ClusterID,
+		ownerPodUIDEnvVar:       string(pod.UID),
+		ownerPodNamespaceEnvVar: pod.Namespace,
+		ownerPodNameEnvVar:      pod.Name,
+	}
+}
+
+// getContainerGroupPodKey returns the namespace/name of the pod a container group was created for
+func getContainerGroupPodKey(containerGroup saladclient.ContainerGroup) (string, bool) {
+	env := containerGroup.Container.EnvironmentVariables
+	namespace, hasNamespace := env[ownerPodNamespaceEnvVar]
+	name, hasName := env[ownerPodNameEnvVar]
+	if !hasNamespace || !hasName {
+		return "", false
+	}
+	return getPodKey(namespace, name), true
+}
+
+// isContainerGroupOf guards lookups by name against container groups created for another pod.
+// Container groups without pod metadata are trusted.
+func isContainerGroupOf(containerGroup saladclient.ContainerGroup, namespace, name string) bool {
+	key, ok := getContainerGroupPodKey(containerGroup)
+	return !ok || key == getPodKey(namespace, name)
+}
+
+// isOfThisCluster reports whether the container group was created by a node of this cluster.
+// Container groups without the cluster tag are trusted.
+func (p *SaladCloudProvider) isOfThisCluster(containerGroup saladclient.ContainerGroup) bool {
+	clusterID, ok := containerGroup.Container.EnvironmentVariables[ownerClusterIDEnvVar]
+	return !ok || clusterID == p.inputVars.ClusterID
+}
+
+func getPodKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// setOwnershipMetadata copies the ownership tags of a container group onto the pod built from it
+func setOwnershipMetadata(pod *corev1.Pod, containerGroup saladclient.ContainerGroup) {
+	env := containerGroup.Container.EnvironmentVariables
+	nodeName, hasNodeName := env[ownerNodeNameEnvVar]
+	if !hasNodeName {
+		// Not created by a virtual kubelet
+		return
+	}
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	pod.Labels[ownerNodeNameLabel] = nodeName
+	pod.Labels[ownerClusterIDLabel] = env[ownerClusterIDEnvVar]
+	if uid, ok := getContainerGroupReplicaSetUID(containerGroup); ok {
+		// Shared by the pods of a ReplicaSet, the pod stands for the ReplicaSet
+		pod.Labels[ownerReplicaSetLabel] = uid
+		pod.Namespace = env[ownerPodNamespaceEnvVar]
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "ReplicaSet",
+			Name:       env[ownerReplicaSetNameEnvVar],
+			UID:        types.UID(uid),
+			Controller: &controller,
+		}}
+		return
+	}
+	pod.UID = types.UID(env[ownerPodUIDEnvVar])
+	pod.Namespace = env[ownerPodNamespaceEnvVar]
+	pod.Name = env[ownerPodNameEnvVar]
+}
+
+// isOwnedBy reports whether a pod returned by GetContainerGroupPods belongs to the given node and cluster
+func isOwnedBy(pod *corev1.Pod, nodeName, clusterID string) bool {
+	owner, ok := pod.Labels[ownerNodeNameLabel]
+	if !ok {
+		return false
+	}
+	return owner == nodeName && pod.Labels[ownerClusterIDLabel] == clusterID
+}
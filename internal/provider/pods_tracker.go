@@ -7,7 +7,6 @@
 	"time"
 
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
-	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -20,8 +19,9 @@
 var stalePodCleanupInterval = 5 * time.Minute
 
 type PodsTrackerHandler interface {
-	GetPods(ctx context.Context) ([]*corev1.Pod, error)
+	GetContainerGroupPods(ctx context.Context) ([]*corev1.Pod, error)
 	GetPodStatus(ctx context.Context, namespace, name string) (*corev1.PodStatus, error)
+	GetPodStatuses(ctx context.Context, pods []*corev1.Pod) (map[string]*corev1.PodStatus, error)
 	DeletePod(ctx context.Context, pod *corev1.Pod) error
 }
 
@@ -31,6 +31,12 @@ type PodsTracker struct {
 	podLister      corev1listers.PodLister
 	updateCallback func(*corev1.Pod)
 	handler        PodsTrackerHandler
+	nodeName       string
+	clusterID      string
+	// Report stale container groups without deleting them
+	dryRun bool
+	// How long the container groups of finished pods are kept, zero keeps them until the pods are deleted
+	finishedTTL time.Duration
 }
 
 func (pt *PodsTracker) BeginPodTracking(ctx context.Context) {
@@ -45,10 +51,14 @@ func (pt *PodsTracker) BeginPodTracking(ctx context.Context) {
 			log.G(ctx).WithError(ctx.Err()).Debug("Pod status update loop exiting")
 			return
 		case <-statusUpdatesTimer.C:
+			start := time.Now()
 			pt.updatePods()
+			podsTrackerLoopDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
 			statusUpdatesTimer.Reset(podStatusUpdateInterval)
 		case <-cleanupTimer.C:
+			start := time.Now()
 			pt.removeStalePods()
+			podsTrackerLoopDuration.WithLabelValues("cleanup").Observe(time.Since(start).Seconds())
 			cleanupTimer.Reset(stalePodCleanupInterval)
 		}
 	}
@@ -61,8 +71,32 @@ func (pt *PodsTracker) updatePods() {
 		pt.logger.WithError(err).Errorf("failed to retrieve pods list")
 		return
 	}
+	setPodsByPhase(k8sPods)
+	pods := make([]*corev1.Pod, 0, len(k8sPods))
 	for _, pod := range k8sPods {
+		if pt.isPodStatusUpdateRequired(pod) {
+			pt.logger.Infof("handlePodStatusUpdate: Skipping pod status update for pod %s", pod.Name)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if len(pods) == 0 {
+		return
+	}
+
+	// One listing covers every pod, only pods missing from it are fetched one by one
+	statuses, err := pt.handler.GetPodStatuses(pt.ctx, pods)
+	if err != nil {
+		pt.logger.WithError(err).Errorf("failed to retrieve container groups list")
+		return
+	}
+	for _, pod := range pods {
 		updatedPod := pod.DeepCopy()
+		if status, ok := statuses[getPodKey(pod.Namespace, pod.Name)]; ok {
+			status.DeepCopyInto(&updatedPod.Status)
+			pt.updateCallback(updatedPod)
+			continue
+		}
 		ok := pt.handlePodUpdates(updatedPod)
 		if ok {
 			pt.updateCallback(updatedPod)
@@ -77,23 +111,50 @@ func (pt *PodsTracker) removeStalePods() {
 		pt.logger.WithError(err).Errorf("removeStalePodsInCluster: failed to retrieve pods list")
 		return
 	}
-	activePods, err := pt.handler.GetPods(pt.ctx)
+	activePods, err := pt.handler.GetContainerGroupPods(pt.ctx)
 	if err != nil {
 		pt.logger.WithError(err).Errorf("removeStalePodsInCluster: failed to retrieve active container groups")
 		return
 	}
-	clusterPodMap := make(map[string]bool)
+	clusterPodMap := make(map[string]*corev1.Pod)
+	clusterReplicaSets := make(map[string]bool)
 	for _, pod := range clusterPods {
-		key := utils.GetPodName(pod.Namespace, pod.Name, pod)
-		clusterPodMap[key] = true
+		clusterPodMap[getPodKey(pod.Namespace, pod.Name)] = pod
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			clusterReplicaSets[string(owner.UID)] = true
+		}
 	}
 	for i := range activePods {
-		if _, exists := clusterPodMap[activePods[i].Spec.Containers[0].Name]; !exists {
-			pt.logger.Debugf("removeStalePodsInCluster: removing stale pod: %s", activePods[i].Name)
+		containerGroupName := activePods[i].Spec.Containers[0].Name
+		if !isOwnedBy(activePods[i], pt.nodeName, pt.clusterID) {
+			// Never touch container groups created by hand, other tools or other nodes
+			continue
+		}
+		var exists bool
+		if uid := activePods[i].Labels[ownerReplicaSetLabel]; uid != "" {
+			// Shared by the pods of a ReplicaSet, stale once none of them is left on the node
+			exists = clusterReplicaSets[uid]
+		} else if activePods[i].Name == "" {
+			// Created before container groups carried the namespace and name of their pod
+			pt.logger.Warnf("removeStalePodsInCluster: skipping container group %s without pod metadata", containerGroupName)
+			continue
+		} else if clusterPod, ok := clusterPodMap[getPodKey(activePods[i].Namespace, activePods[i].Name)]; ok {
+			// The container group of a finished pod is only kept for the TTL
+			exists = !isFinishedContainerGroupExpired(clusterPod, activePods[i], pt.finishedTTL, time.Now())
+		}
+		if !exists {
+			if pt.dryRun {
+				pt.logger.Infof("removeStalePodsInCluster: dry run, would remove stale pod: %s", containerGroupName)
+				continue
+			}
+			pt.logger.Debugf("removeStalePodsInCluster: removing stale pod: %s", containerGroupName)
 			err := pt.handler.DeletePod(pt.ctx, activePods[i])
 			if err != nil {
-				pt.logger.WithError(err).Errorf("removeStalePodsInCluster: failed to remove stale pod %v", activePods[i].Name)
+				stalePodDeletionsTotal.WithLabelValues("error").Inc()
+				pt.logger.WithError(err).Errorf("removeStalePodsInCluster: failed to remove stale pod %v", containerGroupName)
+				continue
 			}
+			stalePodDeletionsTotal.WithLabelValues("deleted").Inc()
 		}
 	}
 }
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeTrackerHandler struct {
+	pods     []*corev1.Pod
+	deleted  []string
+	statuses map[string]*corev1.PodStatus
+	// Pods whose status was fetched one by one
+	fetched []string
+}
+
+func (h *fakeTrackerHandler) GetContainerGroupPods(context.Context) ([]*corev1.Pod, error) {
+	return h.pods, nil
+}
+
+func (h *fakeTrackerHandler) GetPodStatus(_ context.Context, namespace, name string) (*corev1.PodStatus, error) {
+	h.fetched = append(h.fetched, namespace+"/"+name)
+	return &corev1.PodStatus{Phase: corev1.PodPending}, nil
+}
+
+func (h *fakeTrackerHandler) GetPodStatuses(context.Context, []*corev1.Pod) (map[string]*corev1.PodStatus, error) {
+	return h.statuses, nil
+}
+
+func (h *fakeTrackerHandler) DeletePod(_ context.Context, pod *corev1.Pod) error {
+	h.deleted = append(h.deleted, pod.Name)
+	return nil
+}
+
+func newTestPodLister(pods ...*corev1.Pod) corev1listers.PodLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		_ = indexer.Add(pod)
+	}
+	return corev1listers.NewPodLister(indexer)
+}
+
+// newProviderPod returns a pod the way GetContainerGroupPods builds it from a container group
+func newProviderPod(name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: utils.GetContainerGroupName("default", name)}},
+		},
+	}
+}
+
+func Test_removeStalePods(t *testing.T) {
+	owned := map[string]string{ownerNodeNameLabel: "saladcloud-node", ownerClusterIDLabel: "cluster"}
+	otherNode := map[string]string{ownerNodeNameLabel: "other-node", ownerClusterIDLabel: "cluster"}
+	clusterPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	replicaSetPod := newReplicaSetPod("api-1", "live")
+	withReplicaSet := func(uid string) map[string]string {
+		return map[string]string{ownerNodeNameLabel: "saladcloud-node", ownerClusterIDLabel: "cluster", ownerReplicaSetLabel: uid}
+	}
+
+	handler := &fakeTrackerHandler{
+		pods: []*corev1.Pod{
+			newProviderPod("web", owned),
+			newProviderPod("stale", owned),
+			newProviderPod("other", otherNode),
+			newProviderPod("manual", nil),
+			// Owned but without pod metadata
+			newProviderPod("", owned),
+			// Shared by the pods of a ReplicaSet
+			newProviderPod("live-replica-set", withReplicaSet("live")),
+			newProviderPod("stale-replica-set", withReplicaSet("gone")),
+		},
+	}
+	tracker := &PodsTracker{
+		ctx:       context.Background(),
+		logger:    log.G(context.Background()),
+		podLister: newTestPodLister(clusterPod, replicaSetPod),
+		handler:   handler,
+		nodeName:  "saladcloud-node",
+		clusterID: "cluster",
+	}
+
+	// Dry run never deletes
+	tracker.dryRun = true
+	tracker.removeStalePods()
+	assert.Empty(t, handler.deleted)
+
+	// Only owned container groups missing from the cluster are deleted
+	tracker.dryRun = false
+	tracker.removeStalePods()
+	assert.Equal(t, []string{"stale", "stale-replica-set"}, handler.deleted)
+}
+
+func Test_updatePods(t *testing.T) {
+	listed := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "listed"}}
+	missing := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "missing"}}
+	failed := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "failed"},
+		Status:     corev1.PodStatus{Phase: corev1.PodFailed},
+	}
+	handler := &fakeTrackerHandler{
+		statuses: map[string]*corev1.PodStatus{"default/listed": {Phase: corev1.PodRunning}},
+	}
+	updated := make(map[string]corev1.PodPhase)
+	tracker := &PodsTracker{
+		ctx:       context.Background(),
+		logger:    log.G(context.Background()),
+		podLister: newTestPodLister(listed, missing, failed),
+		handler:   handler,
+		updateCallback: func(pod *corev1.Pod) {
+			updated[pod.Name] = pod.Status.Phase
+		},
+	}
+
+	tracker.updatePods()
+	assert.Equal(t, map[string]corev1.PodPhase{"listed": corev1.PodRunning, "missing": corev1.PodPending}, updated)
+	// Only the pod missing from the listing is fetched on its own
+	assert.Equal(t, []string{"default/missing"}, handler.fetched)
+}
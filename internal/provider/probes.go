@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Probe settings defaulted the way Kubernetes does for fields left unset
+const (
+	defaultProbeTimeoutSeconds   = 1
+	defaultProbePeriodSeconds    = 10
+	defaultProbeSuccessThreshold = 1
+	defaultProbeFailureThreshold = 3
+)
+
+// Ranges of the probe settings accepted by SaladCloud
+var (
+	probeInitialDelaySecondsRange = [2]int32{0, 1200}
+	probeTimeoutSecondsRange      = [2]int32{1, 60}
+	probePeriodSecondsRange       = [2]int32{1, 120}
+	probeSuccessThresholdRange    = [2]int32{1, 10}
+	probeFailureThresholdRange    = [2]int32{1, 20}
+)
+
+// Returned for probes that SaladCloud cannot express
+var errInvalidProbe = errors.New("invalid probe")
+
+// containerProbe holds the fields shared by the liveness, readiness and startup probes of SaladCloud
+type containerProbe struct {
+	failureThreshold    int32
+	initialDelaySeconds int32
+	periodSeconds       int32
+	successThreshold    int32
+	timeoutSeconds      int32
+	exec                *saladclient.ContainerGroupProbeExec
+	grpc                *saladclient.ContainerGroupProbeGrpc
+	http                *saladclient.ContainerGroupProbeHttp
+	tcp                 *saladclient.ContainerGroupProbeTcp
+}
+
+// getContainerProbe translates the probe of the container, resolving named ports against the
+// container ports. It returns nil when the container has no such probe.
+func getContainerProbe(kind string, k8sProbe *corev1.Probe, container corev1.Container) (*containerProbe, error) {
+	if k8sProbe == nil || *k8sProbe == (corev1.Probe{}) {
+		return nil, nil
+	}
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s probe: %s", errInvalidProbe, kind, fmt.Sprintf(format, args...))
+	}
+
+	probe := &containerProbe{
+		failureThreshold:    getValueOrDefault(k8sProbe.FailureThreshold, defaultProbeFailureThreshold),
+		initialDelaySeconds: k8sProbe.InitialDelaySeconds,
+		periodSeconds:       getValueOrDefault(k8sProbe.PeriodSeconds, defaultProbePeriodSeconds),
+		successThreshold:    getValueOrDefault(k8sProbe.SuccessThreshold, defaultProbeSuccessThreshold),
+		timeoutSeconds:      getValueOrDefault(k8sProbe.TimeoutSeconds, defaultProbeTimeoutSeconds),
+	}
+	for _, setting := range []struct {
+		name   string
+		value  int32
+		bounds [2]int32
+	}{
+		{"initialDelaySeconds", probe.initialDelaySeconds, probeInitialDelaySecondsRange},
+		{"timeoutSeconds", probe.timeoutSeconds, probeTimeoutSecondsRange},
+		{"periodSeconds", probe.periodSeconds, probePeriodSecondsRange},
+		{"successThreshold", probe.successThreshold, probeSuccessThresholdRange},
+		{"failureThreshold", probe.failureThreshold, probeFailureThresholdRange},
+	} {
+		if setting.value < setting.bounds[0] || setting.value > setting.bounds[1] {
+			return nil, invalid("%s %d is not between %d and %d", setting.name, setting.value, setting.bounds[0], setting.bounds[1])
+		}
+	}
+	if k8sProbe.TerminationGracePeriodSeconds != nil {
+		return nil, invalid("terminationGracePeriodSeconds is not supported")
+	}
+
+	handlers := 0
+	if k8sProbe.Exec != nil {
+		handlers++
+		if len(k8sProbe.Exec.Command) == 0 {
+			return nil, invalid("exec has no command")
+		}
+		probe.exec = saladclient.NewContainerGroupProbeExec(k8sProbe.Exec.Command)
+	}
+	if k8sProbe.GRPC != nil {
+		handlers++
+		port, err := getProbePort(intstr.FromInt32(k8sProbe.GRPC.Port), container.Ports)
+		if err != nil {
+			return nil, invalid("grpc %s", err)
+		}
+		service := ""
+		if k8sProbe.GRPC.Service != nil {
+			service = *k8sProbe.GRPC.Service
+		}
+		probe.grpc = saladclient.NewContainerGroupProbeGrpc(port, service)
+	}
+	if k8sProbe.HTTPGet != nil {
+		handlers++
+		if k8sProbe.HTTPGet.Host != "" {
+			return nil, invalid("httpGet host is not supported")
+		}
+		port, err := getProbePort(k8sProbe.HTTPGet.Port, container.Ports)
+		if err != nil {
+			return nil, invalid("httpGet %s", err)
+		}
+		var scheme saladclient.ContainerProbeHttpScheme
+		switch k8sProbe.HTTPGet.Scheme {
+		case "", corev1.URISchemeHTTP:
+			scheme = saladclient.CONTAINERPROBEHTTPSCHEME_HTTP
+		case corev1.URISchemeHTTPS:
+			scheme = saladclient.CONTAINERPROBEHTTPSCHEME_HTTPS
+		default:
+			return nil, invalid("httpGet scheme %q is not supported", k8sProbe.HTTPGet.Scheme)
+		}
+		headers := make([]saladclient.ContainerGroupProbeHttpHeader, 0, len(k8sProbe.HTTPGet.HTTPHeaders))
+		for _, header := range k8sProbe.HTTPGet.HTTPHeaders {
+			headers = append(headers, saladclient.ContainerGroupProbeHttpHeader{Name: header.Name, Value: header.Value})
+		}
+		path := k8sProbe.HTTPGet.Path
+		if path == "" {
+			path = "/"
+		}
+		probe.http = saladclient.NewContainerGroupProbeHttp(headers, path, port, *saladclient.NewNullableContainerProbeHttpScheme(&scheme))
+	}
+	if k8sProbe.TCPSocket != nil {
+		handlers++
+		if k8sProbe.TCPSocket.Host != "" {
+			return nil, invalid("tcpSocket host is not supported")
+		}
+		port, err := getProbePort(k8sProbe.TCPSocket.Port, container.Ports)
+		if err != nil {
+			return nil, invalid("tcpSocket %s", err)
+		}
+		probe.tcp = saladclient.NewContainerGroupProbeTcp(port)
+	}
+	if handlers != 1 {
+		return nil, invalid("exactly one of exec, grpc, httpGet and tcpSocket must be set, found %d", handlers)
+	}
+	return probe, nil
+}
+
+// getProbePort resolves a probe port given by number or by the name of a container port
+func getProbePort(port intstr.IntOrString, ports []corev1.ContainerPort) (int32, error) {
+	if port.Type == intstr.String {
+		for _, containerPort := range ports {
+			if containerPort.Name == port.StrVal {
+				return containerPort.ContainerPort, nil
+			}
+		}
+		return 0, fmt.Errorf("port %q is not the name of a container port", port.StrVal)
+	}
+	if port.IntVal < 1 || port.IntVal > 65535 {
+		return 0, fmt.Errorf("port %d is out of range", port.IntVal)
+	}
+	return port.IntVal, nil
+}
+
+func (p *SaladCloudProvider) getWorkloadContainerLivenessProbeFrom(container corev1.Container) (*saladclient.ContainerGroupLivenessProbe, error) {
+	probe, err := getContainerProbe("liveness", container.LivenessProbe, container)
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	if probe.successThreshold != 1 {
+		// Kubernetes requires it of liveness and startup probes as well
+		return nil, fmt.Errorf("%w: liveness probe: successThreshold must be 1", errInvalidProbe)
+	}
+	livenessProbe := saladclient.NewContainerGroupLivenessProbe(probe.failureThreshold, probe.initialDelaySeconds, probe.periodSeconds, probe.successThreshold, probe.timeoutSeconds)
+	livenessProbe.Exec, livenessProbe.Grpc, livenessProbe.Http, livenessProbe.Tcp = probe.exec, probe.grpc, probe.http, probe.tcp
+	return livenessProbe, nil
+}
+
+func (p *SaladCloudProvider) getWorkloadContainerReadinessProbeFrom(container corev1.Container) (*saladclient.ContainerGroupReadinessProbe, error) {
+	probe, err := getContainerProbe("readiness", container.ReadinessProbe, container)
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	readinessProbe := saladclient.NewContainerGroupReadinessProbe(probe.failureThreshold, probe.initialDelaySeconds, probe.periodSeconds, probe.successThreshold, probe.timeoutSeconds)
+	readinessProbe.Exec, readinessProbe.Grpc, readinessProbe.Http, readinessProbe.Tcp = probe.exec, probe.grpc, probe.http, probe.tcp
+	return readinessProbe, nil
+}
+
+func (p *SaladCloudProvider) getWorkloadContainerStartupProbeFrom(container corev1.Container) (*saladclient.ContainerGroupStartupProbe, error) {
+	probe, err := getContainerProbe("startup", container.StartupProbe, container)
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	if probe.successThreshold != 1 {
+		return nil, fmt.Errorf("%w: startup probe: successThreshold must be 1", errInvalidProbe)
+	}
+	startupProbe := saladclient.NewContainerGroupStartupProbe(probe.failureThreshold, probe.initialDelaySeconds, probe.periodSeconds, probe.successThreshold, probe.timeoutSeconds)
+	startupProbe.Exec, startupProbe.Grpc, startupProbe.Http, startupProbe.Tcp = probe.exec, probe.grpc, probe.http, probe.tcp
+	return startupProbe, nil
+}
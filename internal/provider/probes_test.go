@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func Test_getContainerProbes(t *testing.T) {
+	p, _ := newProvider()
+	container := corev1.Container{
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}, {Name: "grpc", ContainerPort: 9000}},
+		LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+			GRPC: &corev1.GRPCAction{Port: 9000},
+		}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/healthz",
+				Port:   intstr.FromString("http"),
+				Scheme: corev1.URISchemeHTTPS,
+			}},
+			PeriodSeconds:    5,
+			SuccessThreshold: 2,
+		},
+		StartupProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("grpc")},
+		}},
+	}
+
+	liveness, err := p.getWorkloadContainerLivenessProbeFrom(container)
+	require.NoError(t, err)
+	assert.Equal(t, saladclient.NewContainerGroupProbeGrpc(9000, ""), liveness.Grpc)
+	assert.Equal(t, int32(3), liveness.FailureThreshold)
+	assert.Equal(t, int32(10), liveness.PeriodSeconds)
+	assert.Equal(t, int32(1), liveness.SuccessThreshold)
+	assert.Equal(t, int32(1), liveness.TimeoutSeconds)
+
+	readiness, err := p.getWorkloadContainerReadinessProbeFrom(container)
+	require.NoError(t, err)
+	assert.Equal(t, int32(8080), readiness.Http.Port)
+	assert.Equal(t, "/healthz", readiness.Http.Path)
+	assert.Equal(t, saladclient.CONTAINERPROBEHTTPSCHEME_HTTPS, *readiness.Http.Scheme.Get())
+	assert.Equal(t, int32(5), readiness.PeriodSeconds)
+	assert.Equal(t, int32(2), readiness.SuccessThreshold)
+
+	startup, err := p.getWorkloadContainerStartupProbeFrom(container)
+	require.NoError(t, err)
+	assert.Equal(t, int32(9000), startup.Tcp.Port)
+
+	none, err := p.getWorkloadContainerStartupProbeFrom(corev1.Container{})
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func Test_getContainerProbe_invalid(t *testing.T) {
+	container := corev1.Container{Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}}
+	httpGet := corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromInt32(8080)}}
+	gracePeriod := int64(10)
+
+	for name, probe := range map[string]*corev1.Probe{
+		"no handler":     {PeriodSeconds: 5},
+		"two handlers":   {ProbeHandler: corev1.ProbeHandler{HTTPGet: httpGet.HTTPGet, Exec: &corev1.ExecAction{Command: []string{"true"}}}},
+		"unknown port":   {ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("grpc")}}},
+		"zero port":      {ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{}}},
+		"host":           {ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Host: "example.com", Port: intstr.FromInt32(8080)}}},
+		"empty command":  {ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{}}},
+		"long timeout":   {ProbeHandler: httpGet, TimeoutSeconds: 61},
+		"long period":    {ProbeHandler: httpGet, PeriodSeconds: 121},
+		"many failures":  {ProbeHandler: httpGet, FailureThreshold: 21},
+		"grace period":   {ProbeHandler: httpGet, TerminationGracePeriodSeconds: &gracePeriod},
+		"unknown scheme": {ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromInt32(8080), Scheme: "FTP"}}},
+	} {
+		_, err := getContainerProbe("readiness", probe, container)
+		assert.ErrorIs(t, err, errInvalidProbe, name)
+	}
+
+	// Kubernetes only allows a success threshold of 1 for liveness and startup probes
+	p, _ := newProvider()
+	container.LivenessProbe = &corev1.Probe{ProbeHandler: httpGet, SuccessThreshold: 2}
+	_, err := p.getWorkloadContainerLivenessProbeFrom(container)
+	assert.ErrorIs(t, err, errInvalidProbe)
+}
@@ -17,9 +17,7 @@
 	saladclient "github.com/SaladTechnologies/salad-client"
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	dto "github.com/prometheus/client_model/go"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	nodeapi "github.com/virtual-kubelet/virtual-kubelet/node/api"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
@@ -27,8 +25,9 @@
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
-	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+	"k8s.io/client-go/tools/record"
 )
 
 type SaladCloudProvider struct {
@@ -44,46 +43,86 @@ type SaladCloudProvider struct {
 	podsTracker     *PodsTracker
 	podLister       corev1listers.PodLister
 	secretLister    corev1listers.SecretLister
+	configMapLister corev1listers.ConfigMapLister
+	serviceLister   corev1listers.ServiceLister
+	kubeClient      kubernetes.Interface
+	eventRecorder   record.EventRecorder
+	breaker         *circuitBreaker
+	lifecycle       *lifecycleTracker
+	instances       *instancesTracker
+	legacyNames     *legacyNamesTracker
+	containerGroups containerGroupsSnapshot
+	startTime       time.Time
+	gpuClassCatalog *gpuClassCatalog
 }
 
+// Node capacity used when it is not configured
 const (
-	// Set defaults to allow ...
-	defaultPodsLimit = "1000"
-	// pods at per pod usage of...
-	// 16 vCPU
-	defaultCPUCoresNumber = "16000"
-	// 60G memory
-	defaultMemorySize = "60Ti"
-	// 50G storage
-	defaultStorageSize = "50Ti"
+	DefaultNodePods    = "1000"
+	DefaultNodeCPU     = "16000"
+	DefaultNodeMemory  = "60Ti"
+	DefaultNodeStorage = "50Ti"
 
 	defaultOperatingSystem = "Linux"
 )
 
-func NewSaladCloudProvider(ctx context.Context, inputVars models.InputVars, providerConfig nodeutil.ProviderConfig) (*SaladCloudProvider, error) {
+func NewSaladCloudProvider(ctx context.Context, inputVars models.InputVars, providerConfig nodeutil.ProviderConfig, eventRecorder record.EventRecorder, kubeClient kubernetes.Interface) (*SaladCloudProvider, error) {
+	if eventRecorder == nil {
+		// Discards every event
+		eventRecorder = &record.FakeRecorder{}
+	}
+	logger := log.G(ctx)
+	breaker := newCircuitBreaker(inputVars.APICircuitBreakerThreshold, inputVars.APICircuitBreakerCooldown)
+	apiConfig := saladclient.NewConfiguration()
+	apiConfig.HTTPClient = &http.Client{Transport: newAPITransport(http.DefaultTransport, inputVars, breaker, logger)}
 	cloudProvider := &SaladCloudProvider{
-		inputVars:    inputVars,
-		apiClient:    saladclient.NewAPIClient(saladclient.NewConfiguration()),
-		logger:       log.G(ctx),
-		podLister:    providerConfig.Pods,
-		secretLister: providerConfig.Secrets,
+		inputVars:       inputVars,
+		apiClient:       saladclient.NewAPIClient(apiConfig),
+		logger:          logger,
+		podLister:       providerConfig.Pods,
+		secretLister:    providerConfig.Secrets,
+		configMapLister: providerConfig.ConfigMaps,
+		serviceLister:   providerConfig.Services,
+		kubeClient:      kubeClient,
+		eventRecorder:   eventRecorder,
+		breaker:         breaker,
+		lifecycle:       newLifecycleTracker(),
+		instances:       newInstancesTracker(),
+		legacyNames:     newLegacyNamesTracker(),
+		startTime:       time.Now(),
+		gpuClassCatalog: newGPUClassCatalog(gpuClassCatalogTTL),
+	}
+	if err := cloudProvider.setNodeCapacity(); err != nil {
+		return nil, err
 	}
-	cloudProvider.setNodeCapacity()
 
 	return cloudProvider, nil
 }
 
-func (p *SaladCloudProvider) setNodeCapacity() {
-	p.cpu = defaultCPUCoresNumber
-	p.memory = defaultMemorySize
-	p.pods = defaultPodsLimit
-	p.storage = defaultStorageSize
+func (p *SaladCloudProvider) setNodeCapacity() error {
+	p.cpu = getValueOrDefault(p.inputVars.NodeCPU, DefaultNodeCPU)
+	p.memory = getValueOrDefault(p.inputVars.NodeMemory, DefaultNodeMemory)
+	p.pods = getValueOrDefault(p.inputVars.NodePods, DefaultNodePods)
+	p.storage = getValueOrDefault(p.inputVars.NodeStorage, DefaultNodeStorage)
 	p.operatingSystem = defaultOperatingSystem
+	for name, value := range map[string]string{"CPU": p.cpu, "memory": p.memory, "pods": p.pods, "storage": p.storage} {
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("invalid node %s capacity %q: %w", name, value, err)
+		}
+	}
+	return nil
 }
 
-func (p *SaladCloudProvider) ConfigureNode(_ context.Context, node *corev1.Node) {
-	node.Status.Capacity = p.getNodeCapacity()
-	node.Status.Allocatable = p.getNodeCapacity()
+func getValueOrDefault[T comparable](value, defaultValue T) T {
+	var zero T
+	if value == zero {
+		return defaultValue
+	}
+	return value
+}
+
+func (p *SaladCloudProvider) ConfigureNode(ctx context.Context, node *corev1.Node) {
+	node.Status.Capacity, node.Status.Allocatable = p.getNodeResources(ctx)
 	node.Status.NodeInfo.OperatingSystem = p.operatingSystem
 }
 
@@ -106,48 +145,128 @@ func (p *SaladCloudProvider) NotifyPods(ctx context.Context, notifierCallback fu
 		handler:        p,
 		ctx:            ctx,
 		logger:         p.logger,
+		nodeName:       p.inputVars.NodeName,
+		clusterID:      p.inputVars.ClusterID,
+		dryRun:         p.inputVars.StalePodCleanupDryRun,
+		finishedTTL:    p.inputVars.FinishedContainerGroupTTL,
 	}
-	go p.podsTracker.BeginPodTracking(ctx)
+	go func() {
+		p.adoptContainerGroups(ctx, notifierCallback)
+		p.podsTracker.BeginPodTracking(ctx)
+	}()
 }
 
 func (p *SaladCloudProvider) CreatePod(ctx context.Context, pod *corev1.Pod) error {
-	_, span := trace.StartSpan(ctx, "CreatePod")
+	ctx, span := trace.StartSpan(ctx, "CreatePod")
 	defer span.End()
 	p.logger.Infof("CreatePod: %s", pod.Name)
-	createContainerObject := p.createContainersObject(pod)
-	p.logger.Debugf(" createContainerObject: %+v", createContainerObject)
-	createContainerGroup := p.createContainerGroup(createContainerObject, pod)
-	p.logger.Debugf(" createContainerGroup: %+v", createContainerGroup[0])
+	mainContainer, err := p.getMainContainer(pod)
+	if err == nil {
+		err = p.validateGPURequests(mainContainer)
+	}
+	if err != nil {
+		// Retrying will never make an unsupported pod work
+		p.logger.WithError(err).Errorf("CreatePod: rejecting pod %s", pod.Name)
+		p.markPodFailed(pod, err.Error())
+		return nil
+	}
+	createContainerGroup, err := p.getContainerGroupPrototype(ctx, pod)
+	if isPodSpecError(err) {
+		p.logger.WithError(err).Errorf("CreatePod: rejecting pod %s", pod.Name)
+		p.markPodFailed(pod, err.Error())
+		return nil
+	}
+	if err != nil {
+		// Missing secrets or config maps may still show up, let the pod controller retry
+		p.logger.WithError(err).Errorf("CreatePod: %s", pod.Name)
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerConfigError, "Failed to build container group: %v", err)
+		return err
+	}
+	p.logger.Debugf(" createContainerGroup: %+v", createContainerGroup)
+	if owner := p.getReplicaSetOwner(pod); owner != nil {
+		// Network errors and replica count races are requeued by the pod controller with backoff
+		return p.createReplicaSetPod(ctx, pod, owner, createContainerGroup)
+	}
 
+	createCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
 	_, r, err := p.apiClient.
 		ContainerGroupsAPI.CreateContainerGroup(
-		p.contextWithAuth(),
+		createCtx,
 		p.inputVars.OrganizationName,
 		p.inputVars.ProjectName).ContainerGroupPrototype(
-		createContainerGroup[0],
+		createContainerGroup,
 	).Execute()
 	if err != nil {
+		if r == nil || isRetryableStatusCode(r.StatusCode) {
+			// Network errors, throttling and server errors are requeued by the pod controller with backoff
+			p.logger.WithError(err).Errorf("CreatePod: failed to create container group for pod %s, retrying", pod.Name)
+			recordCreatePodFailure(transientProblemType)
+			return models.NewSaladCloudError(err, r)
+		}
 		// Get response body for error info
-		pd, err := utils.GetResponseBody(r)
-		if err != nil {
-			p.logger.Errorf("CreatePod: %s", err)
+		pd, bodyErr := utils.GetResponseBody(r)
+		if bodyErr != nil {
+			p.logger.Errorf("CreatePod: %s", bodyErr)
+			recordCreatePodFailure("")
 			return err
 		}
 
-		// Also handle 403 and 429?
-		if r != nil && r.StatusCode == http.StatusBadRequest {
-			if *pd.Type == "name_conflict" {
-				// The exciting duplicate name condition!
-				p.logger.Errorf("Name %s has already been used in provider project %s/%s", pod.Name, p.inputVars.OrganizationName, p.inputVars.ProjectName)
-			} else {
-				p.logger.Errorf("Error type %s in `ContainerGroupsAPI.ContainerGroupPrototype`", *pd.Type)
+		if r.StatusCode == http.StatusBadRequest && pd.GetType() == "name_conflict" {
+			// The exciting duplicate name condition! It may be our own container group from a previous run.
+			if p.adoptContainerGroup(ctx, pod, createContainerGroup) {
+				p.setCreatedPodStatus(pod)
+				return nil
 			}
+			p.logger.Errorf("Name %s has already been used in provider project %s/%s", pod.Name, p.inputVars.OrganizationName, p.inputVars.ProjectName)
 		} else {
-			p.logger.Errorf("Error when calling `ContainerGroupsAPI.ContainerGroupPrototype`", r)
+			p.logger.Errorf("Error type %s in `ContainerGroupsAPI.ContainerGroupPrototype`: %+v", pd.GetType(), *pd)
 		}
-		return err
+
+		// Validation, permission and quota errors will fail the same way on every retry
+		recordCreatePodFailure(pd.GetType())
+		message := getProblemMessage(pd)
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupCreateFailed, "Failed to create container group %s: %s", createContainerGroup.Name, message)
+		p.markPodFailed(pod, message)
+		return nil
+	}
+
+	p.lifecycle.created(createContainerGroup.Name)
+	p.instances.forget(createContainerGroup.Name)
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupCreated, "Created container group %s", createContainerGroup.Name)
+	p.setCreatedPodStatus(pod)
+	p.logger.Infof("Container %s created and initialized", pod.Name)
+	return nil
+}
+
+// isPodSpecError reports whether the pod can never be created as it is
+func isPodSpecError(err error) bool {
+	return errors.Is(err, errUnknownGPUClass) || errors.Is(err, errInvalidNetworking) || errors.Is(err, errInvalidProbe) ||
+		errors.Is(err, errPodSpecificField)
+}
+
+// isRetryableStatusCode reports whether a failed SaladCloud API call may succeed when sent again
+func isRetryableStatusCode(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// getProblemMessage renders the title and detail of a SaladCloud error for pod statuses and events
+func getProblemMessage(pd *saladclient.ProblemDetails) string {
+	title, detail := pd.GetTitle(), pd.GetDetail()
+	switch {
+	case title == "":
+		return detail
+	case detail == "":
+		return title
 	}
+	return title + ": " + detail
+}
 
+// setCreatedPodStatus reports a pod whose container group was just created as scheduled but not
+// ready, until SaladCloud runs an instance of it
+func (p *SaladCloudProvider) setCreatedPodStatus(pod *corev1.Pod) {
 	now := metav1.NewTime(time.Now())
 	pod.CreationTimestamp = now
 	pod.Status = corev1.PodStatus{
@@ -155,42 +274,102 @@ func (p *SaladCloudProvider) CreatePod(ctx context.Context, pod *corev1.Pod) err
 		StartTime: &now,
 		Conditions: []corev1.PodCondition{
 			{
-				Type:   corev1.PodInitialized,
-				Status: corev1.ConditionTrue,
+				Type:               corev1.PodScheduled,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: now,
 			},
 			{
-				Type:   corev1.PodReady,
-				Status: corev1.ConditionTrue,
+				Type:               corev1.PodInitialized,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: now,
 			},
 			{
-				Type:   corev1.PodScheduled,
-				Status: corev1.ConditionTrue,
+				Type:               corev1.ContainersReady,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: now,
+			},
+			{
+				Type:               corev1.PodReady,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: now,
 			},
 		},
 	}
+	ignored := p.getIgnoredContainers(pod)
 	for _, container := range pod.Spec.Containers {
+		if ignored[container.Name] {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, getIgnoredContainerStatus(container))
+			continue
+		}
 		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
 			Name:         container.Name,
 			Image:        container.Image,
-			Ready:        true,
+			Ready:        false,
 			RestartCount: 0,
+			State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"},
+			},
 		})
 	}
-
-	p.logger.Infof("Container %s created and initialized", pod.Name)
-	return nil
 }
 
-func (p *SaladCloudProvider) UpdatePod(_ context.Context, pod *corev1.Pod) error {
-	p.logger.Debugf("UpdatePod: %s: %+v", utils.GetPodName(pod.Namespace, pod.Name, pod), pod)
-	return nil
+func (p *SaladCloudProvider) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
+	ctx, span := trace.StartSpan(ctx, "UpdatePod")
+	defer span.End()
+	podname := p.getContainerGroupName(pod)
+	p.logger.Debugf("UpdatePod: %s: %+v", podname, pod)
+	if owner := p.getReplicaSetOwner(pod); owner != nil {
+		return p.syncReplicaSetReplicas(ctx, pod, owner)
+	}
+
+	desired, err := p.getContainerGroupPrototype(ctx, pod)
+	if err != nil {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to build container group: %v", err)
+		return err
+	}
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	live, r, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, podname).Execute()
+	if err != nil {
+		pd, err := utils.GetResponseBody(r)
+		if err != nil {
+			p.logger.Errorf("UpdatePod: %s", err)
+			return err
+		}
+		p.logger.Errorf("`ContainerGroupsAPI.GetContainerGroup`: Error: %+v", *pd)
+		return models.NewSaladCloudError(fmt.Errorf("%s", pd.GetDetail()), r)
+	}
+	if !isContainerGroupOf(*live, pod.Namespace, pod.Name) || !p.isOfThisCluster(*live) {
+		// Never change nor recreate a container group that only shares the name
+		err := fmt.Errorf("container group %s belongs to another pod", podname)
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to update container group: %v", err)
+		return &models.APIError{StatusCode: http.StatusConflict, Message: err.Error()}
+	}
+
+	return p.reconcileContainerGroup(ctx, pod, desired, *live, true)
 }
 
 func (p *SaladCloudProvider) DeletePod(ctx context.Context, pod *corev1.Pod) error {
-	_, span := trace.StartSpan(ctx, "DeletePod")
+	ctx, span := trace.StartSpan(ctx, "DeletePod")
 	defer span.End()
-	p.logger.Debugf("Deleting pod %s", utils.GetPodName(pod.Namespace, pod.Name, pod))
-	response, err := p.apiClient.ContainerGroupsAPI.DeleteContainerGroup(p.contextWithAuth(), p.inputVars.OrganizationName, p.inputVars.ProjectName, utils.GetPodName(pod.Namespace, pod.Name, pod)).Execute()
+	containerGroupName := p.getContainerGroupName(pod)
+	p.logger.Debugf("Deleting pod %s", containerGroupName)
+	if owner := p.getReplicaSetOwner(pod); owner != nil {
+		shared, err := p.deleteReplicaSetPod(ctx, pod, owner)
+		if err != nil {
+			return err
+		}
+		if shared {
+			// The other pods of the ReplicaSet keep the container group
+			pod.Status.Phase = corev1.PodSucceeded
+			pod.Status.Reason = "Pod Deleted"
+			p.setDeletedContainerStatuses(pod)
+			return nil
+		}
+	}
+	deleteCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	response, err := p.apiClient.ContainerGroupsAPI.DeleteContainerGroup(deleteCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroupName).Execute()
 	pod.Status.Phase = corev1.PodSucceeded
 	pod.Status.Reason = "Pod Deleted"
 	if err != nil {
@@ -202,8 +381,25 @@ func (p *SaladCloudProvider) DeletePod(ctx context.Context, pod *corev1.Pod) err
 		}
 
 		p.logger.Errorf("`ContainerGroupsAPI.DeletePod`: Error: %+v", *pd)
+		if response.StatusCode == http.StatusNotFound {
+			p.lifecycle.deleted(containerGroupName)
+			p.instances.forget(containerGroupName)
+			p.legacyNames.forget(pod.Namespace, pod.Name)
+			return err
+		}
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupDeleteFailed, "Failed to delete container group %s: %s", containerGroupName, getProblemMessage(pd))
 		return err
 	}
+	p.lifecycle.deleted(containerGroupName)
+	p.instances.forget(containerGroupName)
+	p.legacyNames.forget(pod.Namespace, pod.Name)
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupDeleted, "Deleted container group %s", containerGroupName)
+	p.setDeletedContainerStatuses(pod)
+	return nil
+}
+
+// setDeletedContainerStatuses marks the containers of a deleted pod as terminated
+func (p *SaladCloudProvider) setDeletedContainerStatuses(pod *corev1.Pod) {
 	now := metav1.Now()
 	for idx := range pod.Status.ContainerStatuses {
 		pod.Status.ContainerStatuses[idx].Ready = false
@@ -216,12 +412,22 @@ func (p *SaladCloudProvider) DeletePod(ctx context.Context, pod *corev1.Pod) err
 		}
 		p.logger.Infof("Container %s deleted", pod.Status.ContainerStatuses[idx].Name)
 	}
-	return nil
 }
 
-func (p *SaladCloudProvider) GetPod(_ context.Context, namespace string, name string) (*corev1.Pod, error) {
-	podname := utils.GetPodName(namespace, name, nil)
-	resp, r, err := saladclient.NewAPIClient(saladclient.NewConfiguration()).ContainerGroupsAPI.GetContainerGroup(p.contextWithAuth(), p.inputVars.OrganizationName, p.inputVars.ProjectName, podname).Execute()
+func (p *SaladCloudProvider) GetPod(ctx context.Context, namespace string, name string) (*corev1.Pod, error) {
+	ctx, span := trace.StartSpan(ctx, "GetPod")
+	defer span.End()
+
+	owner := p.getReplicaSetOwnerOf(namespace, name)
+	podname := p.getContainerGroupNameOf(namespace, name, owner)
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	resp, r, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, podname).Execute()
+	if err != nil && owner == nil && r != nil && r.StatusCode == http.StatusNotFound {
+		if containerGroup, ok := p.getLegacyContainerGroup(ctx, namespace, name); ok {
+			resp, podname, err = containerGroup, containerGroup.Name, nil
+		}
+	}
 	if err != nil {
 		// Get response body for error info
 		pd, err := utils.GetResponseBody(r)
@@ -237,6 +443,10 @@ func (p *SaladCloudProvider) GetPod(_ context.Context, namespace string, name st
 		}
 		return nil, err
 	}
+	if !isContainerGroupOfPod(*resp, namespace, name, owner) {
+		p.logger.Warnf("`ContainerGroupsAPI.GetPod`: %s belongs to another pod", podname)
+		return nil, nil
+	}
 	startTime := metav1.NewTime(resp.CreateTime)
 	pod := &corev1.Pod{
 		Spec: corev1.PodSpec{
@@ -259,28 +469,37 @@ func (p *SaladCloudProvider) GetPod(_ context.Context, namespace string, name st
 			},
 		},
 	}
+	setOwnershipMetadata(pod, *resp)
 
 	return pod, nil
 }
 
-func (p *SaladCloudProvider) contextWithAuth() context.Context {
+// contextWithAuth derives the context of a SaladCloud API call from the caller's context, so that
+// cancellation and tracing reach the HTTP request. A zero timeout keeps the caller's deadline.
+func (p *SaladCloudProvider) contextWithAuth(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
 	auth := context.WithValue(
-		context.Background(),
+		ctx,
 		saladclient.ContextAPIKeys,
 		map[string]saladclient.APIKey{
 			"ApiKeyAuth": {Key: p.inputVars.ApiKey},
 		},
 	)
-	return auth
+	if timeout <= 0 {
+		return context.WithCancel(auth)
+	}
+	return context.WithTimeout(auth, timeout)
 }
 
 func (p *SaladCloudProvider) GetPodStatus(ctx context.Context, namespace string, name string) (*corev1.PodStatus, error) {
-	_, span := trace.StartSpan(ctx, "GetPodStatus")
+	ctx, span := trace.StartSpan(ctx, "GetPodStatus")
 	defer span.End()
 
-	podname := utils.GetPodName(namespace, name, nil)
+	owner := p.getReplicaSetOwnerOf(namespace, name)
+	podname := p.getContainerGroupNameOf(namespace, name, owner)
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
 	containerGroup, response, err := p.apiClient.ContainerGroupsAPI.
-		GetContainerGroup(p.contextWithAuth(), p.inputVars.OrganizationName, p.inputVars.ProjectName, podname).
+		GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, podname).
 		Execute()
 	if err != nil {
 		// Get response body for error info
@@ -301,47 +520,161 @@ func (p *SaladCloudProvider) GetPodStatus(ctx context.Context, namespace string,
 		}
 		return nil, models.NewSaladCloudError(err, response)
 	}
+	if !isContainerGroupOfPod(*containerGroup, namespace, name, owner) {
+		return nil, &models.APIError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("container group %s belongs to another pod", podname)}
+	}
+
+	p.publishAccessDomain(ctx, namespace, name, containerGroup)
+	status := p.podStatusFromContainerGroup(namespace, name, containerGroup)
+	if owner != nil {
+		p.projectReplicaSetPodStatus(namespace, name, owner, containerGroup, status)
+	}
+	p.setInstanceStatus(ctx, namespace, name, owner, containerGroup, status)
+	pod := p.getListedPod(namespace, name)
+	p.setJobStatus(ctx, pod, containerGroup, status)
+	setReadinessGates(pod, status)
+	return status, nil
+}
 
+// GetPodStatuses returns the status of every pod whose container group shows up in a single
+// listing of the project, keyed by namespace/name. Pods missing from the result need a GetPodStatus.
+func (p *SaladCloudProvider) GetPodStatuses(ctx context.Context, pods []*corev1.Pod) (map[string]*corev1.PodStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "GetPodStatuses")
+	defer span.End()
+
+	containerGroups, err := p.listContainerGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	containerGroupsByPod := make(map[string]*saladclient.ContainerGroup, len(containerGroups))
+	containerGroupsByReplicaSet := make(map[string]*saladclient.ContainerGroup)
+	for i := range containerGroups {
+		if key, ok := getContainerGroupPodKey(containerGroups[i]); ok {
+			containerGroupsByPod[key] = &containerGroups[i]
+		} else if uid, ok := getContainerGroupReplicaSetUID(containerGroups[i]); ok {
+			containerGroupsByReplicaSet[uid] = &containerGroups[i]
+		}
+	}
+
+	statuses := make(map[string]*corev1.PodStatus, len(pods))
+	for _, pod := range pods {
+		key := getPodKey(pod.Namespace, pod.Name)
+		owner := p.getReplicaSetOwner(pod)
+		var containerGroup *saladclient.ContainerGroup
+		var ok bool
+		if owner != nil {
+			containerGroup, ok = containerGroupsByReplicaSet[string(owner.UID)]
+		} else {
+			containerGroup, ok = containerGroupsByPod[key]
+		}
+		if !ok {
+			continue
+		}
+		p.publishAccessDomain(ctx, pod.Namespace, pod.Name, containerGroup)
+		statuses[key] = p.podStatusFromContainerGroup(pod.Namespace, pod.Name, containerGroup)
+		if owner != nil {
+			p.projectReplicaSetPodStatus(pod.Namespace, pod.Name, owner, containerGroup, statuses[key])
+		}
+		p.setInstanceStatus(ctx, pod.Namespace, pod.Name, owner, containerGroup, statuses[key])
+		p.setJobStatus(ctx, pod, containerGroup, statuses[key])
+		setReadinessGates(pod, statuses[key])
+	}
+	return statuses, nil
+}
+
+func (p *SaladCloudProvider) podStatusFromContainerGroup(namespace, name string, containerGroup *saladclient.ContainerGroup) *corev1.PodStatus {
+	p.recordLifecycleEvents(namespace, name, containerGroup)
 	phase := utils.GetPodPhaseFromContainerGroupState(containerGroup.CurrentState)
+	// Instances passing a readiness probe are only known from the instances themselves
 	ready := containerGroup.CurrentState.Status == saladclient.CONTAINERGROUPSTATUS_RUNNING &&
-		containerGroup.CurrentState.InstanceStatusCounts.RunningCount > 0
+		containerGroup.CurrentState.InstanceStatusCounts.RunningCount > 0 &&
+		containerGroup.ReadinessProbe == nil
 	p.logger.Infof("Pod %s computed status - Phase: %v, Ready: %v, Status: %v, RunningCount: %d",
-		podname, phase, ready, containerGroup.CurrentState.Status, containerGroup.CurrentState.InstanceStatusCounts.RunningCount)
+		containerGroup.Name, phase, ready, containerGroup.CurrentState.Status, containerGroup.CurrentState.InstanceStatusCounts.RunningCount)
+
+	containerStatuses := p.getContainerStatuses(namespace, name, containerGroup, ready)
+	containersReady := areContainersReady(containerStatuses)
 
 	startTime := metav1.NewTime(containerGroup.CreateTime)
+	conditions := []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+		{Type: corev1.PodInitialized, Status: corev1.ConditionTrue},
+		{Type: corev1.PodReady, Status: getConditionStatus(containersReady)},
+		{Type: corev1.ContainersReady, Status: getConditionStatus(containersReady)},
+	}
+	if condition, ok := getAccessDomainCondition(containerGroup); ok {
+		conditions = append(conditions, condition)
+	}
 	return &corev1.PodStatus{
-		Phase:     phase,
-		StartTime: &startTime,
-		Conditions: []corev1.PodCondition{
-			{Type: corev1.PodReady, Status: getConditionStatus(ready)},
-			{Type: corev1.ContainersReady, Status: getConditionStatus(ready)},
-		},
-		ContainerStatuses: []corev1.ContainerStatus{
-			{
-				Name:  containerGroup.Name,
-				Image: containerGroup.Container.Image,
-				Ready: ready,
-				State: getContainerState(containerGroup.CurrentState),
-			},
-		},
-	}, nil
+		Phase:             phase,
+		StartTime:         &startTime,
+		Conditions:        conditions,
+		ContainerStatuses: containerStatuses,
+	}
 }
 
-func (p *SaladCloudProvider) GetPods(_ context.Context) ([]*corev1.Pod, error) {
-	resp, r, err := p.apiClient.ContainerGroupsAPI.ListContainerGroups(p.contextWithAuth(), p.inputVars.OrganizationName, p.inputVars.ProjectName).Execute()
+// listContainerGroups returns every container group of the project. The API returns the whole
+// collection in one response, so this is a single request regardless of the project size.
+func (p *SaladCloudProvider) listContainerGroups(ctx context.Context) ([]saladclient.ContainerGroup, error) {
+	listCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	resp, r, err := p.apiClient.ContainerGroupsAPI.ListContainerGroups(listCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName).Execute()
 	if err != nil {
 		// Get response body for error info
 		pd, err := utils.GetResponseBody(r)
 		if err != nil {
-			p.logger.Errorf("GetPods: %s", err)
+			p.logger.Errorf("listContainerGroups: %s", err)
 			return nil, err
 		}
 
-		p.logger.Errorf("`ContainerGroupsAPI.GetPods`: Error: %+v", *pd)
+		p.logger.Errorf("`ContainerGroupsAPI.ListContainerGroups`: Error: %+v", *pd)
+		return nil, models.NewSaladCloudError(fmt.Errorf("%s", pd.GetDetail()), r)
+	}
+	p.containerGroups.set(resp.GetItems())
+	for _, containerGroup := range resp.GetItems() {
+		p.legacyNames.observe(containerGroup)
+	}
+	return resp.GetItems(), nil
+}
+
+// GetPods returns the pods of this node that have a container group. The container group of a
+// ReplicaSet stands for each of its pods on the node, since virtual-kubelet deletes the returned
+// pods it does not know.
+func (p *SaladCloudProvider) GetPods(ctx context.Context) ([]*corev1.Pod, error) {
+	ctx, span := trace.StartSpan(ctx, "GetPods")
+	defer span.End()
+
+	containerGroupPods, err := p.GetContainerGroupPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(containerGroupPods))
+	for _, pod := range containerGroupPods {
+		if uid := pod.Labels[ownerReplicaSetLabel]; uid != "" {
+			pods = append(pods, p.getReplicaSetContainerGroupPods(pod, uid)...)
+			continue
+		}
+		if pod.Name == "" {
+			// Created before container groups carried the namespace and name of their pod
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// GetContainerGroupPods returns a pod built from every container group owned by this node, the
+// container group of a ReplicaSet being a single pod without a name
+func (p *SaladCloudProvider) GetContainerGroupPods(ctx context.Context) ([]*corev1.Pod, error) {
+	ctx, span := trace.StartSpan(ctx, "GetContainerGroupPods")
+	defer span.End()
+
+	containerGroups, err := p.listContainerGroups(ctx)
+	if err != nil {
 		return nil, err
 	}
 	pods := make([]*corev1.Pod, 0)
-	for _, containerGroup := range resp.GetItems() {
+	for _, containerGroup := range containerGroups {
 		startTime := metav1.NewTime(containerGroup.CreateTime)
 		pod := &corev1.Pod{
 			Spec: corev1.PodSpec{
@@ -360,10 +693,16 @@ func (p *SaladCloudProvider) GetPods(_ context.Context) ([]*corev1.Pod, error) {
 						Name:  containerGroup.Name,
 						Image: containerGroup.Container.Image,
 						Ready: utils.GetPodPhaseFromContainerGroupState(containerGroup.CurrentState) == corev1.PodRunning,
+						State: getContainerState(containerGroup.CurrentState),
 					},
 				},
 			},
 		}
+		setOwnershipMetadata(pod, containerGroup)
+		if !isOwnedBy(pod, p.inputVars.NodeName, p.inputVars.ClusterID) {
+			// Never let container groups created by hand, by other tools or by other nodes be deleted
+			continue
+		}
 
 		pods = append(pods, pod)
 
@@ -371,10 +710,6 @@ func (p *SaladCloudProvider) GetPods(_ context.Context) ([]*corev1.Pod, error) {
 	return pods, nil
 }
 
-func (p *SaladCloudProvider) GetContainerLogs(_ context.Context, namespace, podName, containerName string, opts nodeapi.ContainerLogOpts) (io.ReadCloser, error) {
-	return nil, nil
-}
-
 func (p *SaladCloudProvider) RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, attach nodeapi.AttachIO) error {
 	return nil
 }
@@ -383,20 +718,12 @@ func (p *SaladCloudProvider) AttachToContainer(_ context.Context, namespace, pod
 	return nil
 }
 
-func (p *SaladCloudProvider) GetStatsSummary(context.Context) (*stats.Summary, error) {
-	return nil, nil
-}
-
-func (p *SaladCloudProvider) GetMetricsResource(context.Context) ([]*dto.MetricFamily, error) {
-	return nil, nil
-}
-
 func (p *SaladCloudProvider) PortForward(ctx context.Context, namespace, pod string, port int32, stream io.ReadWriteCloser) error {
 	return nil
 }
 
-func (p *SaladCloudProvider) getContainerEnvironment(podMetadata metav1.ObjectMeta, container corev1.Container) map[string]string {
-	marshallerObjectMetadata, err := json.Marshal(podMetadata)
+func (p *SaladCloudProvider) getContainerEnvironment(pod *corev1.Pod, container corev1.Container) (map[string]string, error) {
+	marshallerObjectMetadata, err := json.Marshal(pod.ObjectMeta)
 	if err != nil {
 		log.G(context.Background()).Errorf("Failed Marshalling ", err)
 	}
@@ -404,6 +731,16 @@ func (p *SaladCloudProvider) getContainerEnvironment(podMetadata metav1.ObjectMe
 	if marshallerObjectMetadata != nil {
 		envMap["POD_METADATA_YAML"] = string(marshallerObjectMetadata)
 	}
+	// Variables from envFrom come first so that env entries override them, like in a kubelet
+	for _, envFrom := range container.EnvFrom {
+		values, err := p.getEnvFromSourceValues(pod.Namespace, envFrom)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range values {
+			envMap[envFrom.Prefix+name] = value
+		}
+	}
 	for _, env := range container.Env {
 		if env.ValueFrom == nil {
 			ignore := false
@@ -417,307 +754,124 @@ func (p *SaladCloudProvider) getContainerEnvironment(podMetadata metav1.ObjectMe
 				envMap[env.Name] = env.Value
 			}
 		} else {
-			// TODO Handle environment variable from source
-			log.G(context.Background()).Debugf("Environment variable support from %s is not yet implemented", env.ValueFrom.String())
-		}
-	}
-	return envMap
-}
-
-func (p *SaladCloudProvider) createContainersObject(pod *corev1.Pod) []saladclient.CreateContainer {
-	createContainersArray := make([]saladclient.CreateContainer, 0)
-	for _, container := range pod.Spec.Containers {
-		cpu, memory := utils.GetPodResource(pod.Spec)
-		gpuClasses, err := p.getGPUClasses(pod)
-		if err != nil || gpuClasses == nil {
-			gpuClasses = make([]string, 0)
-		}
-		containerResourceRequirement := saladclient.NewContainerResourceRequirements(int32(cpu), int32(memory), gpuClasses)
-		createContainer := saladclient.NewCreateContainer(container.Image, *containerResourceRequirement)
-
-		createContainer.SetEnvironmentVariables(p.getContainerEnvironment(pod.ObjectMeta, container))
-		if container.Command != nil {
-			createContainer.SetCommand(container.Command)
-		}
-
-		// Handle image pull secrets
-		if ips, err := p.getImagePullSecrets(pod); err != nil {
-			p.logger.Errorf("Error getting image pull secrets: %v", err)
-		} else if len(ips) > 0 {
-			// SaladCloud currently supports one registry auth per container
-			auth := saladclient.ContainerRegistryAuthentication{
-				Basic: saladclient.NewContainerRegistryAuthenticationBasic(ips[0].Username, ips[0].Password),
+			value, ok, err := p.getEnvVarSourceValue(pod, container, env.ValueFrom)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve environment variable %s: %w", env.Name, err)
+			}
+			if ok {
+				envMap[env.Name] = value
 			}
-			createContainer.RegistryAuthentication = &auth
-		}
-
-		logging := p.getContainerLogging(pod)
-		if logging != nil {
-			createContainer.Logging = logging
-		}
-		priority, err := p.getContainerPriority(pod)
-		if err == nil && priority != nil {
-			createContainer.Priority.Set(priority)
 		}
-		createContainersArray = append(createContainersArray, *createContainer)
 	}
-	return createContainersArray
+	return envMap, nil
 }
 
-func (p *SaladCloudProvider) getWorkloadContainerLivenessProbeFrom(
-	k8sProbe *corev1.Probe,
-) (*saladclient.ContainerGroupLivenessProbe, error) {
-
-	if k8sProbe == nil || *k8sProbe == (corev1.Probe{}) {
-		// No probe specified.
-		return nil, nil
+func (p *SaladCloudProvider) createContainerObject(ctx context.Context, pod *corev1.Pod, container corev1.Container) (saladclient.CreateContainer, error) {
+	cpu, memory := utils.GetContainerResource(container)
+	gpuClasses, err := p.getGPUClasses(ctx, pod, container)
+	if err != nil {
+		return saladclient.CreateContainer{}, fmt.Errorf("failed to get GPU classes: %w", err)
 	}
+	if gpuClasses == nil {
+		gpuClasses = make([]string, 0)
+	}
+	containerResourceRequirement := saladclient.NewContainerResourceRequirements(int32(cpu), int32(memory), gpuClasses)
+	createContainer := saladclient.NewCreateContainer(container.Image, *containerResourceRequirement)
 
-	// Create the typed LivenessProbe:
-	probe := saladclient.NewContainerGroupLivenessProbe(
-		k8sProbe.FailureThreshold,
-		k8sProbe.InitialDelaySeconds,
-		k8sProbe.PeriodSeconds,
-		k8sProbe.SuccessThreshold,
-		k8sProbe.TimeoutSeconds,
-	)
-
-	// Fill in gRPC details if present:
-	if k8sProbe.GRPC != nil {
-		grpcProbe := saladclient.NewContainerGroupProbeGrpc(k8sProbe.GRPC.Port, *k8sProbe.GRPC.Service)
-		probe.SetGrpc(*grpcProbe)
+	environment, err := p.getContainerEnvironment(pod, container)
+	if err != nil {
+		return saladclient.CreateContainer{}, err
+	}
+	for name, value := range p.getOwnershipEnvironment(pod) {
+		environment[name] = value
+	}
+	createContainer.SetEnvironmentVariables(environment)
+	if container.Command != nil {
+		createContainer.SetCommand(container.Command)
 	}
 
-	// Fill in HTTP details if present:
-	if k8sProbe.HTTPGet != nil {
-		headers := make([]saladclient.ContainerGroupProbeHttpHeader, 0)
-		for _, header := range k8sProbe.HTTPGet.HTTPHeaders {
-			headers = append(headers, saladclient.ContainerGroupProbeHttpHeader{Name: header.Name, Value: header.Value})
+	// Handle image pull secrets
+	if ips, err := p.getImagePullSecrets(pod); err != nil {
+		p.logger.Errorf("Error getting image pull secrets: %v", err)
+	} else if len(ips) > 0 {
+		// SaladCloud currently supports one registry auth per container
+		auth := saladclient.ContainerRegistryAuthentication{
+			Basic: saladclient.NewContainerRegistryAuthenticationBasic(ips[0].Username, ips[0].Password),
 		}
-		scheme := saladclient.CONTAINERPROBEHTTPSCHEME_HTTP
-		probeScheme := saladclient.NewNullableContainerProbeHttpScheme(&scheme)
-		httpProbe := saladclient.NewContainerGroupProbeHttp(
-			headers,
-			k8sProbe.HTTPGet.Path,
-			int32(k8sProbe.HTTPGet.Port.IntValue()),
-			*probeScheme)
-		probe.SetHttp(*httpProbe)
+		createContainer.RegistryAuthentication = &auth
 	}
 
-	// Fill in TCP details if present:
-	if k8sProbe.TCPSocket != nil {
-		tcpProbe := saladclient.NewContainerGroupProbeTcp(
-			int32(k8sProbe.TCPSocket.Port.IntValue()),
-		)
-		probe.SetTcp(*tcpProbe)
+	logging := p.getContainerLogging(pod)
+	if logging != nil {
+		createContainer.Logging = logging
 	}
-
-	// Fill in Exec details if present:
-	if k8sProbe.Exec != nil {
-		execProbe := saladclient.NewContainerGroupProbeExec(k8sProbe.Exec.Command)
-		probe.SetExec(*execProbe)
+	priority, err := p.getContainerPriority(pod)
+	if err == nil && priority != nil {
+		createContainer.Priority.Set(priority)
 	}
-
-	// Wrap in nullable and return
-	return probe, nil
+	return *createContainer, nil
 }
 
-func (p *SaladCloudProvider) getWorkloadContainerReadinessProbeFrom(
-	k8sProbe *corev1.Probe,
-) (*saladclient.ContainerGroupReadinessProbe, error) {
-
-	if k8sProbe == nil || *k8sProbe == (corev1.Probe{}) {
-		return nil, nil
+// getContainerGroupPrototype builds the container group for the main container of the pod
+func (p *SaladCloudProvider) getContainerGroupPrototype(ctx context.Context, pod *corev1.Pod) (saladclient.ContainerGroupPrototype, error) {
+	mainContainer, err := p.getMainContainer(pod)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-
-	// Create the typed ReadinessProbe:
-	probe := saladclient.NewContainerGroupReadinessProbe(
-		k8sProbe.FailureThreshold,
-		k8sProbe.InitialDelaySeconds,
-		k8sProbe.PeriodSeconds,
-		k8sProbe.SuccessThreshold,
-		k8sProbe.TimeoutSeconds,
-	)
-
-	// Optional gRPC:
-	if k8sProbe.GRPC != nil {
-		grpcProbe := saladclient.NewContainerGroupProbeGrpc(k8sProbe.GRPC.Port, *k8sProbe.GRPC.Service)
-		probe.SetGrpc(*grpcProbe)
+	networking, err := p.getNetworking(pod, mainContainer)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-
-	// Optional HTTP:
-	if k8sProbe.HTTPGet != nil {
-		headers := make([]saladclient.ContainerGroupProbeHttpHeader, 0)
-		for _, header := range k8sProbe.HTTPGet.HTTPHeaders {
-			headers = append(headers, saladclient.ContainerGroupProbeHttpHeader{Name: header.Name, Value: header.Value})
-		}
-		scheme := saladclient.CONTAINERPROBEHTTPSCHEME_HTTP
-		probeScheme := saladclient.NewNullableContainerProbeHttpScheme(&scheme)
-		httpProbe := saladclient.NewContainerGroupProbeHttp(
-			headers,
-			k8sProbe.HTTPGet.Path,
-			int32(k8sProbe.HTTPGet.Port.IntValue()),
-			*probeScheme)
-		probe.SetHttp(*httpProbe)
+	createContainer, err := p.createContainerObject(ctx, pod, mainContainer)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-
-	// Optional TCP:
-	if k8sProbe.TCPSocket != nil {
-		tcpProbe := saladclient.NewContainerGroupProbeTcp(
-			int32(k8sProbe.TCPSocket.Port.IntValue()),
-		)
-		probe.SetTcp(*tcpProbe)
+	createContainerGroup, err := p.createContainerGroup(createContainer, mainContainer, pod)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-
-	// Optional Exec:
-	if k8sProbe.Exec != nil {
-		execProbe := saladclient.NewContainerGroupProbeExec(k8sProbe.Exec.Command)
-		probe.SetExec(*execProbe)
+	if networking != nil {
+		createContainerGroup.SetNetworking(*networking)
 	}
-
-	return probe, nil
+	return createContainerGroup, nil
 }
 
-func (p *SaladCloudProvider) getWorkloadContainerStartupProbeFrom(
-	k8sProbe *corev1.Probe,
-) (*saladclient.ContainerGroupStartupProbe, error) {
-
-	if k8sProbe == nil || *k8sProbe == (corev1.Probe{}) {
-		return nil, nil
-	}
-
-	// Create the typed StartupProbe:
-	probe := saladclient.NewContainerGroupStartupProbe(
-		k8sProbe.FailureThreshold,
-		k8sProbe.InitialDelaySeconds,
-		k8sProbe.PeriodSeconds,
-		k8sProbe.SuccessThreshold,
-		k8sProbe.TimeoutSeconds,
+func (p *SaladCloudProvider) createContainerGroup(createContainer saladclient.CreateContainer, mainContainer corev1.Container, pod *corev1.Pod) (saladclient.ContainerGroupPrototype, error) {
+	createContainerGroupRequest := *saladclient.NewContainerGroupPrototype(
+		true,
+		createContainer,
+		p.getContainerGroupName(pod),
+		int32(1),
+		saladclient.CONTAINERRESTARTPOLICY_ALWAYS,
 	)
-
-	// gRPC:
-	if k8sProbe.GRPC != nil {
-		grpcProbe := saladclient.NewContainerGroupProbeGrpc(k8sProbe.GRPC.Port, *k8sProbe.GRPC.Service)
-		probe.SetGrpc(*grpcProbe)
-	}
-
-	// HTTP:
-	if k8sProbe.HTTPGet != nil {
-		headers := make([]saladclient.ContainerGroupProbeHttpHeader, 0)
-		for _, header := range k8sProbe.HTTPGet.HTTPHeaders {
-			headers = append(headers, saladclient.ContainerGroupProbeHttpHeader{Name: header.Name, Value: header.Value})
-		}
-		scheme := saladclient.CONTAINERPROBEHTTPSCHEME_HTTP
-		probeScheme := saladclient.NewNullableContainerProbeHttpScheme(&scheme)
-		httpProbe := saladclient.NewContainerGroupProbeHttp(
-			headers,
-			k8sProbe.HTTPGet.Path,
-			int32(k8sProbe.HTTPGet.Port.IntValue()),
-			*probeScheme)
-		probe.SetHttp(*httpProbe)
-	}
-
-	// TCP:
-	if k8sProbe.TCPSocket != nil {
-		tcpProbe := saladclient.NewContainerGroupProbeTcp(
-			int32(k8sProbe.TCPSocket.Port.IntValue()),
-		)
-		probe.SetTcp(*tcpProbe)
-	}
-
-	// Exec:
-	if k8sProbe.Exec != nil {
-		execProbe := saladclient.NewContainerGroupProbeExec(k8sProbe.Exec.Command)
-		probe.SetExec(*execProbe)
-	}
-
-	return probe, nil
-}
-
-func (p *SaladCloudProvider) createContainerGroup(createContainerList []saladclient.CreateContainer, pod *corev1.Pod) []saladclient.ContainerGroupPrototype {
-	createContainerGroups := make([]saladclient.ContainerGroupPrototype, 0)
-	for _, container := range createContainerList {
-		createContainerGroupRequest := *saladclient.NewContainerGroupPrototype(
-			true,
-			container,
-			utils.GetPodName(pod.Namespace, pod.Name, pod),
-			int32(1),
-			saladclient.CONTAINERRESTARTPOLICY_ALWAYS,
-		)
-		readinessProbe, err := p.getWorkloadContainerReadinessProbeFrom(pod.Spec.Containers[0].ReadinessProbe)
-		if err == nil && readinessProbe != nil {
-			createContainerGroupRequest.ReadinessProbe = readinessProbe
-		} else {
-			log.G(context.Background()).Errorf("Failed to get readinessProbe ", err)
-		}
-		livenessProbe, err := p.getWorkloadContainerLivenessProbeFrom(pod.Spec.Containers[0].LivenessProbe)
-		if err == nil && livenessProbe != nil {
-			createContainerGroupRequest.LivenessProbe = livenessProbe
-		} else {
-			log.G(context.Background()).Errorf("Failed to get livenessProbe ", err)
-		}
-		startupProbe, err := p.getWorkloadContainerStartupProbeFrom(pod.Spec.Containers[0].StartupProbe)
-		if err == nil && startupProbe != nil {
-			createContainerGroupRequest.StartupProbe = startupProbe
-		} else {
-			log.G(context.Background()).Errorf("Failed to get startupProbe ", err)
-		}
-		countryCodes, err := p.getCountryCodes(pod)
-		if err != nil {
-			log.G(context.Background()).Errorf("Failed to get countryCodes ", err)
-		} else {
-			createContainerGroupRequest.SetCountryCodes(countryCodes)
-		}
-		networking, err := p.getNetworking(pod)
-		if err != nil {
-			log.G(context.Background()).Errorf("Failed to get networking ", err)
-		} else if networking != nil {
-			createContainerGroupRequest.SetNetworking(*networking)
-		}
-		restartPolicy, err := p.getRestartPolicy(pod)
-		if err != nil {
-			log.G(context.Background()).Errorf("Failed to get restartPolicy ", err)
-		} else {
-			createContainerGroupRequest.SetRestartPolicy(*restartPolicy)
-		}
-		createContainerGroups = append(createContainerGroups, createContainerGroupRequest)
+	readinessProbe, err := p.getWorkloadContainerReadinessProbeFrom(mainContainer)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-	return createContainerGroups
-}
-
-func (p *SaladCloudProvider) getGPUClasses(pod *corev1.Pod) ([]string, error) {
-	gpuRequestedString, ok := pod.Annotations["salad.com/gpu-classes"]
-	if !ok {
-		return nil, nil
+	createContainerGroupRequest.ReadinessProbe = readinessProbe
+	livenessProbe, err := p.getWorkloadContainerLivenessProbeFrom(mainContainer)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
 	}
-	gpuRequested := strings.Split(gpuRequestedString, ",")
-	saladClientGpuIds := make([]string, 0)
-	var gpuClasses *saladclient.GpuClassesList = nil
-
-	for _, gpu := range gpuRequested {
-		gpuCleaned := strings.TrimSpace(strings.ToLower(gpu))
-		_, uuidErr := uuid.Parse(gpuCleaned)
-		if uuidErr == nil {
-			saladClientGpuIds = append(saladClientGpuIds, gpuCleaned)
-		} else {
-			if gpuClasses == nil {
-				classes, _, err := p.apiClient.OrganizationDataAPI.ListGpuClasses(p.contextWithAuth(), p.inputVars.OrganizationName).Execute()
-				if err != nil {
-					log.G(context.Background()).Errorf("Failed to get gpuClasses ", err)
-					return nil, err
-				} else {
-					gpuClasses = classes
-				}
-			}
-			for _, gpuClass := range gpuClasses.Items {
-				if strings.TrimSpace(strings.ToLower(gpuClass.Name)) == gpuCleaned {
-					saladClientGpuIds = append(saladClientGpuIds, gpuClass.Id)
-					break
-				}
-			}
-		}
+	createContainerGroupRequest.LivenessProbe = livenessProbe
+	startupProbe, err := p.getWorkloadContainerStartupProbeFrom(mainContainer)
+	if err != nil {
+		return saladclient.ContainerGroupPrototype{}, err
+	}
+	createContainerGroupRequest.StartupProbe = startupProbe
+	countryCodes, err := p.getCountryCodes(pod)
+	if err != nil {
+		log.G(context.Background()).Errorf("Failed to get countryCodes ", err)
+	} else {
+		createContainerGroupRequest.SetCountryCodes(countryCodes)
 	}
-	return saladClientGpuIds, nil
+	restartPolicy, err := p.getRestartPolicy(pod)
+	if err != nil {
+		log.G(context.Background()).Errorf("Failed to get restartPolicy ", err)
+	} else {
+		createContainerGroupRequest.SetRestartPolicy(*restartPolicy)
+	}
+	return createContainerGroupRequest, nil
 }
 
 func (p *SaladCloudProvider) getCountryCodes(pod *corev1.Pod) ([]saladclient.CountryCode, error) {
@@ -739,25 +893,6 @@ func (p *SaladCloudProvider) getCountryCodes(pod *corev1.Pod) ([]saladclient.Cou
 	return countryCodes, nil
 }
 
-func (p *SaladCloudProvider) getNetworking(pod *corev1.Pod) (*saladclient.CreateContainerGroupNetworking, error) {
-	protocol, hasProtocol := pod.Annotations["salad.com/networking-protocol"]
-	port, hasPort := pod.Annotations["salad.com/networking-port"]
-	auth, hasAuth := pod.Annotations["salad.com/networking-auth"]
-	if !hasProtocol || !hasPort || !hasAuth {
-		return nil, nil
-	}
-	networkingProtocol, err := saladclient.NewContainerNetworkingProtocolFromValue(protocol)
-	if err != nil {
-		return nil, err
-	}
-	parsedPortInt, err := strconv.Atoi(port)
-	if err != nil {
-		return nil, err
-	}
-	parsedAuth := strings.ToLower(auth) == "true"
-	return saladclient.NewCreateContainerGroupNetworking(parsedAuth, int32(parsedPortInt), *networkingProtocol), nil
-}
-
 func (p *SaladCloudProvider) getRestartPolicy(pod *corev1.Pod) (*saladclient.ContainerRestartPolicy, error) {
 	restartPolicy := "never"
 	if pod.Spec.RestartPolicy == corev1.RestartPolicyAlways {
@@ -824,6 +959,27 @@ func getContainerState(state saladclient.ContainerGroupState) corev1.ContainerSt
 			Running: &corev1.ContainerStateRunning{},
 		}
 	}
+	switch state.Status {
+	case saladclient.CONTAINERGROUPSTATUS_SUCCEEDED, saladclient.CONTAINERGROUPSTATUS_STOPPED:
+		return corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				Reason:     "Completed",
+				StartedAt:  metav1.NewTime(state.StartTime),
+				FinishedAt: metav1.NewTime(state.FinishTime),
+			},
+		}
+	case saladclient.CONTAINERGROUPSTATUS_FAILED:
+		// The workload errors of the container group tell the exit code, when there are any
+		return corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				ExitCode:   unknownExitCode,
+				Reason:     terminationReasonError,
+				Message:    state.GetDescription(),
+				StartedAt:  metav1.NewTime(state.StartTime),
+				FinishedAt: metav1.NewTime(state.FinishTime),
+			},
+		}
+	}
 	return corev1.ContainerState{
 		Waiting: &corev1.ContainerStateWaiting{
 			Reason:  cases.Title(language.English).String(string(state.Status)),
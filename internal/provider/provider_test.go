@@ -2,18 +2,22 @@
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	saladclient "github.com/SaladTechnologies/salad-client"
 	// "github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/provider"
 	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 )
 
@@ -42,7 +46,7 @@ func newProvider() (*SaladCloudProvider, error) {
 	ctx := context.Background()
 	inputs := defaultInputs()
 	pc := nodeutil.ProviderConfig{}
-	return NewSaladCloudProvider(ctx, inputs, pc)
+	return NewSaladCloudProvider(ctx, inputs, pc, nil, nil)
 }
 
 func Test_getCountryCodes(t *testing.T) {
@@ -147,3 +151,132 @@ func Test_getCountryCodes(t *testing.T) {
 	assert.Equal(t, *expectCC, cc)
 
 }
+
+func Test_getMainContainer(t *testing.T) {
+	p, _ := newProvider()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				"salad.com/ignored-containers": "proxy",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}, {Name: "proxy"}},
+		},
+	}
+
+	// Multi-container pods are rejected by default
+	_, err := p.getMainContainer(pod)
+	assert.NotNil(t, err)
+
+	// Annotated sidecars are ignored when allowed
+	p.inputVars.MultiContainerPolicy = MultiContainerPolicyIgnoreSidecars
+	container, err := p.getMainContainer(pod)
+	assert.Nil(t, err)
+	assert.Equal(t, "app", container.Name)
+
+	// Exactly one container must remain
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "worker"})
+	_, err = p.getMainContainer(pod)
+	assert.NotNil(t, err)
+
+	// Unknown container names are rejected
+	pod.Annotations["salad.com/ignored-containers"] = "proxy,worker,missing"
+	_, err = p.getMainContainer(pod)
+	assert.NotNil(t, err)
+}
+
+func Test_podStatusFromContainerGroup_ignoredSidecars(t *testing.T) {
+	p, _ := newProvider()
+	p.inputVars.MultiContainerPolicy = MultiContainerPolicyIgnoreSidecars
+	p.podLister = newTestPodLister(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "web",
+			Annotations: map[string]string{"salad.com/ignored-containers": "proxy"},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "proxy"}}},
+	})
+	containerGroup := newTestContainerGroup("default-web", "app:1")
+
+	// The sidecar is not ready, but it does not keep the pod from being ready
+	status := p.podStatusFromContainerGroup("default", "web", &containerGroup)
+	require.Len(t, status.ContainerStatuses, 2)
+	assert.True(t, status.ContainerStatuses[0].Ready)
+	assert.False(t, status.ContainerStatuses[1].Ready)
+	ready, _ := getPodCondition(status.Conditions, corev1.PodReady)
+	containersReady, _ := getPodCondition(status.Conditions, corev1.ContainersReady)
+	assert.Equal(t, corev1.ConditionTrue, ready.Status)
+	assert.Equal(t, corev1.ConditionTrue, containersReady.Status)
+}
+
+func Test_CreatePod_failures(t *testing.T) {
+	statusCode := http.StatusBadRequest
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(`{"type":"validation_error","title":"Invalid container group","detail":"image is not reachable","status":400}`))
+	}))
+	newPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+		}
+	}
+
+	// Validation errors fail the pod for good
+	pod := newPod()
+	assert.Nil(t, p.CreatePod(context.Background(), pod))
+	assert.Equal(t, corev1.PodFailed, pod.Status.Phase)
+	assert.Equal(t, "ProviderFailed", pod.Status.Reason)
+	assert.Equal(t, "Invalid container group: image is not reachable", pod.Status.Message)
+
+	// Server errors are handed back to the pod controller to retry
+	statusCode = http.StatusServiceUnavailable
+	pod = newPod()
+	assert.NotNil(t, p.CreatePod(context.Background(), pod))
+	assert.NotEqual(t, corev1.PodFailed, pod.Status.Phase)
+}
+
+func Test_GetPods(t *testing.T) {
+	owned := newTestContainerGroup(utils.GetContainerGroupName("default", "web"), "web:1")
+	owned.Container.EnvironmentVariables = map[string]string{
+		ownerNodeNameEnvVar:     "saladcloud-node",
+		ownerPodNamespaceEnvVar: "default",
+		ownerPodNameEnvVar:      "web",
+	}
+	otherNode := newTestContainerGroup(utils.GetContainerGroupName("default", "api"), "api:1")
+	otherNode.Container.EnvironmentVariables = map[string]string{
+		ownerNodeNameEnvVar:     "other-node",
+		ownerPodNamespaceEnvVar: "default",
+		ownerPodNameEnvVar:      "api",
+	}
+	manual := newTestContainerGroup("manual", "manual:1")
+	replicaSet := newTestContainerGroup(utils.GetContainerGroupName("default", "api"), "api:1")
+	replicaSet.Container.EnvironmentVariables = map[string]string{
+		ownerNodeNameEnvVar:      "saladcloud-node",
+		ownerPodNamespaceEnvVar:  "default",
+		ownerReplicaSetUIDEnvVar: "rs-uid",
+	}
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(saladclient.NewContainerGroupCollection([]saladclient.ContainerGroup{owned, otherNode, manual, replicaSet}))
+	}))
+	p.podLister = newTestPodLister(newReplicaSetPod("api-1", "rs-uid"), newReplicaSetPod("api-2", "rs-uid"))
+
+	// Container groups of other nodes and created by hand are left out, and the container group of
+	// a ReplicaSet stands for each of its pods
+	pods, err := p.GetPods(context.Background())
+	require.NoError(t, err)
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	assert.Equal(t, []string{"web", "api-1", "api-2"}, names)
+	assert.Equal(t, "rs-uid", pods[1].Labels[ownerReplicaSetLabel])
+
+	// While stale cleanup sees every container group of the node once
+	pods, err = p.GetContainerGroupPods(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, pods, 2)
+}
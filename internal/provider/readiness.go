@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const readinessGatesNotReadyReason = "ReadinessGatesNotReady"
+
+// setReadinessGates keeps the conditions of the readiness gates of the pod, which other
+// controllers set, and only leaves the pod ready once every one of them is true
+func setReadinessGates(pod *corev1.Pod, status *corev1.PodStatus) {
+	if pod == nil || len(pod.Spec.ReadinessGates) == 0 {
+		return
+	}
+	var unready []string
+	for _, gate := range pod.Spec.ReadinessGates {
+		condition, ok := getPodCondition(pod.Status.Conditions, gate.ConditionType)
+		if !ok {
+			unready = append(unready, fmt.Sprintf("corresponding condition of pod readiness gate %q does not exist", gate.ConditionType))
+			continue
+		}
+		setPodCondition(status, condition)
+		if condition.Status != corev1.ConditionTrue {
+			unready = append(unready, fmt.Sprintf("the status of pod readiness gate %q is not \"True\", but %v", gate.ConditionType, condition.Status))
+		}
+	}
+	if len(unready) == 0 {
+		return
+	}
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == corev1.PodReady && status.Conditions[i].Status == corev1.ConditionTrue {
+			status.Conditions[i].Status = corev1.ConditionFalse
+			status.Conditions[i].Reason = readinessGatesNotReadyReason
+			status.Conditions[i].Message = strings.Join(unready, ", ")
+		}
+	}
+}
+
+// getPodCondition returns the condition of the given type
+func getPodCondition(conditions []corev1.PodCondition, conditionType corev1.PodConditionType) (corev1.PodCondition, bool) {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition, true
+		}
+	}
+	return corev1.PodCondition{}, false
+}
+
+// setPodCondition replaces the condition of the same type, or adds it
+func setPodCondition(status *corev1.PodStatus, condition corev1.PodCondition) {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condition.Type {
+			status.Conditions[i] = condition
+			return
+		}
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
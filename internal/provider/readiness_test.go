@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"testing"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_setCreatedPodStatus(t *testing.T) {
+	p, _ := newProvider()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "web:1"}}},
+	}
+	p.setCreatedPodStatus(pod)
+
+	assert.Equal(t, corev1.PodPending, pod.Status.Phase)
+	scheduled, ok := getPodCondition(pod.Status.Conditions, corev1.PodScheduled)
+	require.True(t, ok)
+	assert.Equal(t, corev1.ConditionTrue, scheduled.Status)
+	ready, ok := getPodCondition(pod.Status.Conditions, corev1.PodReady)
+	require.True(t, ok)
+	assert.Equal(t, corev1.ConditionFalse, ready.Status)
+	require.Len(t, pod.Status.ContainerStatuses, 1)
+	assert.False(t, pod.Status.ContainerStatuses[0].Ready)
+	assert.Equal(t, "ContainerCreating", pod.Status.ContainerStatuses[0].State.Waiting.Reason)
+}
+
+func Test_isInstanceReady(t *testing.T) {
+	containerGroup := newTestContainerGroup("default-web", "web:1")
+	instance := newTestInstance("a", saladclient.CONTAINERGROUPINSTANCESTATE_RUNNING)
+	assert.True(t, isInstanceReady(&instance, &containerGroup))
+
+	// With a readiness probe, the instance has to pass it
+	containerGroup.ReadinessProbe = &saladclient.ContainerGroupReadinessProbe{}
+	assert.False(t, isInstanceReady(&instance, &containerGroup))
+	ready := true
+	instance.Ready = &ready
+	assert.True(t, isInstanceReady(&instance, &containerGroup))
+	instance.State = saladclient.CONTAINERGROUPINSTANCESTATE_CREATING
+	assert.False(t, isInstanceReady(&instance, &containerGroup))
+
+	// Running instances of the container group are not enough
+	p, _ := newProvider()
+	status := p.podStatusFromContainerGroup("default", "web", &containerGroup)
+	condition, _ := getPodCondition(status.Conditions, corev1.PodReady)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+}
+
+func Test_setReadinessGates(t *testing.T) {
+	const gate corev1.PodConditionType = "example.com/load-balancer-ready"
+	pod := &corev1.Pod{Spec: corev1.PodSpec{ReadinessGates: []corev1.PodReadinessGate{{ConditionType: gate}}}}
+	newStatus := func() *corev1.PodStatus {
+		return &corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}}
+	}
+
+	// The gate is not set yet
+	status := newStatus()
+	setReadinessGates(pod, status)
+	ready, _ := getPodCondition(status.Conditions, corev1.PodReady)
+	assert.Equal(t, corev1.ConditionFalse, ready.Status)
+	assert.Equal(t, readinessGatesNotReadyReason, ready.Reason)
+
+	// The condition set by another controller is kept and opens the gate
+	pod.Status.Conditions = []corev1.PodCondition{{Type: gate, Status: corev1.ConditionTrue}}
+	status = newStatus()
+	setReadinessGates(pod, status)
+	ready, _ = getPodCondition(status.Conditions, corev1.PodReady)
+	assert.Equal(t, corev1.ConditionTrue, ready.Status)
+	condition, ok := getPodCondition(status.Conditions, gate)
+	require.True(t, ok)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+}
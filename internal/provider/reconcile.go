@@ -0,0 +1,378 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Environment variables that change on every pod update and must not count as drift
+var driftIgnoredEnvVars = []string{
+	"POD_METADATA_YAML",
+}
+
+// How often and how long to wait for a container group to be deleted before recreating it
+var (
+	containerGroupDeletionPollInterval = 2 * time.Second
+	containerGroupDeletionTimeout      = 2 * time.Minute
+)
+
+// Service link environment variables, such as MY_SERVICE_SERVICE_HOST or MY_SERVICE_PORT_80_TCP,
+// which virtual-kubelet adds for the services of the namespace when the pod is created. Pods from
+// the lister do not have them, so the ones only the live container group has are not drift.
+var serviceLinkEnvVarPattern = regexp.MustCompile(`^[A-Z0-9_]+_(SERVICE_HOST|SERVICE_PORT(_[A-Z0-9_]+)?|PORT(_[0-9]+_(TCP|UDP|SCTP)(_(PROTO|PORT|ADDR))?)?)$`)
+
+// adoptContainerGroups runs once on startup and adopts the container groups left behind by a
+// previous run of this node for the pods that are still bound to it.
+func (p *SaladCloudProvider) adoptContainerGroups(ctx context.Context, notifierCallback func(*corev1.Pod)) {
+	pods, err := p.podLister.List(labels.Everything())
+	if err != nil {
+		p.logger.WithError(err).Error("adoptContainerGroups: failed to retrieve pods list")
+		return
+	}
+	if len(pods) == 0 {
+		return
+	}
+	items, err := p.listContainerGroups(ctx)
+	if err != nil {
+		p.logger.WithError(err).Error("adoptContainerGroups: failed to list container groups")
+		return
+	}
+	containerGroups := make(map[string]saladclient.ContainerGroup)
+	for _, containerGroup := range items {
+		if key, ok := getContainerGroupPodKey(containerGroup); ok {
+			containerGroups[key] = containerGroup
+		}
+	}
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		containerGroup, ok := containerGroups[getPodKey(pod.Namespace, pod.Name)]
+		if !ok || !p.isAdoptable(pod, containerGroup) {
+			continue
+		}
+		desired, err := p.getContainerGroupPrototype(ctx, pod)
+		if err != nil {
+			continue
+		}
+		if err := p.reconcileContainerGroup(ctx, pod, desired, containerGroup, false); err != nil {
+			p.logger.WithError(err).Errorf("adoptContainerGroups: failed to reconcile container group %s", containerGroup.Name)
+			continue
+		}
+		p.logger.Infof("adoptContainerGroups: adopted container group %s for pod %s/%s", containerGroup.Name, pod.Namespace, pod.Name)
+
+		status, err := p.GetPodStatus(ctx, pod.Namespace, pod.Name)
+		if err != nil || status == nil {
+			continue
+		}
+		updatedPod := pod.DeepCopy()
+		status.DeepCopyInto(&updatedPod.Status)
+		notifierCallback(updatedPod)
+	}
+}
+
+// adoptContainerGroup takes over an existing container group with the name of the pod after
+// CreatePod ran into a name conflict. It returns false when the container group is not ours.
+func (p *SaladCloudProvider) adoptContainerGroup(ctx context.Context, pod *corev1.Pod, desired saladclient.ContainerGroupPrototype) bool {
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	containerGroup, r, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, desired.Name).Execute()
+	if err != nil {
+		pd, err := utils.GetResponseBody(r)
+		if err != nil {
+			p.logger.Errorf("adoptContainerGroup: %s", err)
+			return false
+		}
+		p.logger.Errorf("adoptContainerGroup: `ContainerGroupsAPI.GetContainerGroup`: Error: %+v", *pd)
+		return false
+	}
+	if !p.isAdoptable(pod, *containerGroup) {
+		return false
+	}
+	if err := p.reconcileContainerGroup(ctx, pod, desired, *containerGroup, false); err != nil {
+		p.logger.WithError(err).Errorf("adoptContainerGroup: failed to reconcile container group %s", containerGroup.Name)
+		return false
+	}
+	p.logger.Infof("adoptContainerGroup: adopted container group %s for pod %s/%s", containerGroup.Name, pod.Namespace, pod.Name)
+	return true
+}
+
+// isAdoptable reports whether the container group was created for this very pod by a node of this cluster
+func (p *SaladCloudProvider) isAdoptable(pod *corev1.Pod, containerGroup saladclient.ContainerGroup) bool {
+	env := containerGroup.Container.EnvironmentVariables
+	podUID, ok := env[ownerPodUIDEnvVar]
+	if !ok {
+		return false
+	}
+	return podUID == string(pod.UID) && env[ownerClusterIDEnvVar] == p.inputVars.ClusterID
+}
+
+// reconcileContainerGroup updates the live container group when its spec has drifted from the
+// pod, recreating it when the change cannot be applied in place. Adopted container groups are
+// never recreated, the changes that would take it are only reported.
+func (p *SaladCloudProvider) reconcileContainerGroup(ctx context.Context, pod *corev1.Pod, desired saladclient.ContainerGroupPrototype, live saladclient.ContainerGroup, recreate bool) error {
+	if live.Networking == nil && desired.Networking != nil && !hasNetworkingAnnotations(pod) {
+		// Container groups created without a gateway keep running without one, unless the pod asks for it
+		desired.Networking = nil
+	}
+	reasons := getRecreateReasons(desired, live)
+	if len(reasons) > 0 && recreate {
+		p.logger.Infof("Container group %s cannot be updated in place (%s), recreating", live.Name, strings.Join(reasons, ", "))
+		return p.recreateContainerGroup(ctx, pod, desired, reasons)
+	}
+	if len(reasons) > 0 {
+		p.logger.Warnf("Container group %s cannot be updated in place (%s), keeping it", live.Name, strings.Join(reasons, ", "))
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupDrifted, "Container group %s differs from the pod in %s, which takes recreating it; update the pod to recreate it", live.Name, strings.Join(reasons, ", "))
+	}
+
+	patch, drifted := getContainerGroupPatch(desired, live)
+	if !drifted {
+		return nil
+	}
+	p.logger.Infof("Container group %s has drifted from pod %s/%s, updating", live.Name, pod.Namespace, pod.Name)
+	updateCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	_, r, err := p.apiClient.ContainerGroupsAPI.
+		UpdateContainerGroup(updateCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, live.Name).
+		ContainerGroupPatch(*patch).
+		Execute()
+	if err != nil {
+		pd, bodyErr := utils.GetResponseBody(r)
+		if bodyErr == nil {
+			p.logger.Errorf("`ContainerGroupsAPI.UpdateContainerGroup`: Error: %+v", *pd)
+			err = fmt.Errorf("%s: %s", pd.GetTitle(), pd.GetDetail())
+		}
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to update container group %s: %v", live.Name, err)
+		return err
+	}
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupUpdated, "Updated container group %s: %s", live.Name, strings.Join(getPatchedFields(patch), ", "))
+	return nil
+}
+
+// recreateContainerGroup replaces the container group when SaladCloud cannot apply a change in place
+func (p *SaladCloudProvider) recreateContainerGroup(ctx context.Context, pod *corev1.Pod, desired saladclient.ContainerGroupPrototype, reasons []string) error {
+	deleteCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	r, err := p.apiClient.ContainerGroupsAPI.DeleteContainerGroup(deleteCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, desired.Name).Execute()
+	if err != nil && (r == nil || r.StatusCode != http.StatusNotFound) {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to delete container group %s for recreation: %v", desired.Name, err)
+		return err
+	}
+	// The name stays taken until SaladCloud is done deleting the container group
+	if err := p.waitForContainerGroupDeletion(ctx, desired.Name); err != nil {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to recreate container group %s: %v", desired.Name, err)
+		return err
+	}
+	createCtx, cancelCreate := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancelCreate()
+	_, r, err = p.apiClient.ContainerGroupsAPI.
+		CreateContainerGroup(createCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName).
+		ContainerGroupPrototype(desired).
+		Execute()
+	if err != nil {
+		pd, bodyErr := utils.GetResponseBody(r)
+		if bodyErr == nil {
+			err = fmt.Errorf("%s: %s", pd.GetTitle(), pd.GetDetail())
+		}
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to recreate container group %s: %v", desired.Name, err)
+		return err
+	}
+	p.lifecycle.created(desired.Name)
+	p.instances.forget(desired.Name)
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupRecreated, "Recreated container group %s: %s changed", desired.Name, strings.Join(reasons, ", "))
+	return nil
+}
+
+// waitForContainerGroupDeletion polls a deleted container group until it is gone. The error
+// leaves the pod controller to retry the update later.
+func (p *SaladCloudProvider) waitForContainerGroupDeletion(ctx context.Context, containerGroupName string) error {
+	ctx, cancel := context.WithTimeout(ctx, containerGroupDeletionTimeout)
+	defer cancel()
+	ticker := time.NewTicker(containerGroupDeletionPollInterval)
+	defer ticker.Stop()
+	for {
+		getCtx, cancelGet := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+		_, r, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroupName).Execute()
+		cancelGet()
+		if err != nil && r != nil && r.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container group %s is still being deleted: %w", containerGroupName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// getRecreateReasons lists the changed fields that ContainerGroupPatch cannot carry
+func getRecreateReasons(desired saladclient.ContainerGroupPrototype, live saladclient.ContainerGroup) []string {
+	reasons := make([]string, 0)
+	if desired.RestartPolicy != live.RestartPolicy {
+		reasons = append(reasons, "restart policy")
+	}
+	if (desired.Networking == nil) != (live.Networking == nil) {
+		reasons = append(reasons, "networking")
+	} else if desired.Networking != nil && !isNetworkingPatchable(*desired.Networking, *live.Networking) {
+		reasons = append(reasons, "networking")
+	}
+	return reasons
+}
+
+// isNetworkingPatchable reports whether the networking differs at most by the port, the only field
+// of the gateway that can be patched
+func isNetworkingPatchable(desired saladclient.CreateContainerGroupNetworking, live saladclient.ContainerGroupNetworking) bool {
+	return desired.Protocol == live.Protocol &&
+		desired.Auth == live.Auth &&
+		(desired.LoadBalancer == nil || *desired.LoadBalancer == live.LoadBalancer) &&
+		(desired.SingleConnectionLimit == nil || reflect.DeepEqual(desired.SingleConnectionLimit, live.SingleConnectionLimit)) &&
+		(desired.ClientRequestTimeout == nil || reflect.DeepEqual(desired.ClientRequestTimeout, live.ClientRequestTimeout)) &&
+		(desired.ServerResponseTimeout == nil || reflect.DeepEqual(desired.ServerResponseTimeout, live.ServerResponseTimeout))
+}
+
+// getPatchedFields names the fields set in a patch for events and logs
+func getPatchedFields(patch *saladclient.ContainerGroupPatch) []string {
+	fields := make([]string, 0)
+	if container := patch.Container; container != nil {
+		if container.Image.IsSet() {
+			fields = append(fields, "image")
+		}
+		if container.Command != nil {
+			fields = append(fields, "command")
+		}
+		if container.EnvironmentVariables != nil {
+			fields = append(fields, "environment variables")
+		}
+		if container.Priority.IsSet() {
+			fields = append(fields, "priority")
+		}
+		if container.Resources != nil {
+			fields = append(fields, "resources")
+		}
+	}
+	if patch.Replicas.IsSet() {
+		fields = append(fields, "replicas")
+	}
+	if patch.CountryCodes != nil {
+		fields = append(fields, "country codes")
+	}
+	if patch.Networking != nil {
+		fields = append(fields, "networking port")
+	}
+	if patch.LivenessProbe != nil || patch.ReadinessProbe != nil || patch.StartupProbe != nil {
+		fields = append(fields, "probes")
+	}
+	return fields
+}
+
+// getContainerGroupPatch builds a patch holding the fields of the desired container group that
+// differ from the live one, and reports whether there was any difference at all.
+func getContainerGroupPatch(desired saladclient.ContainerGroupPrototype, live saladclient.ContainerGroup) (*saladclient.ContainerGroupPatch, bool) {
+	patch := saladclient.NewContainerGroupPatch()
+	container := saladclient.NewUpdateContainer()
+	drifted := false
+	containerDrifted := false
+
+	if desired.Container.Image != live.Container.Image {
+		container.SetImage(desired.Container.Image)
+		containerDrifted = true
+	}
+	if !slices.Equal(desired.Container.Command, live.Container.Command) {
+		container.SetCommand(desired.Container.Command)
+		containerDrifted = true
+	}
+	if !environmentEqual(desired.Container.EnvironmentVariables, live.Container.EnvironmentVariables) {
+		container.SetEnvironmentVariables(desired.Container.EnvironmentVariables)
+		containerDrifted = true
+	}
+	if !reflect.DeepEqual(desired.Container.Priority.Get(), live.Priority.Get()) && desired.Container.Priority.IsSet() {
+		container.SetPriority(*desired.Container.Priority.Get())
+		containerDrifted = true
+	}
+
+	desiredResources := desired.Container.Resources
+	liveResources := live.Container.Resources
+	if desiredResources.Cpu != liveResources.Cpu ||
+		desiredResources.Memory != liveResources.Memory ||
+		!unorderedEqual(desiredResources.GpuClasses, liveResources.GpuClasses) {
+		resources := saladclient.NewUpdateContainerResources()
+		resources.SetCpu(desiredResources.Cpu)
+		resources.SetMemory(desiredResources.Memory)
+		resources.SetGpuClasses(desiredResources.GpuClasses)
+		container.SetResources(*resources)
+		containerDrifted = true
+	}
+	if containerDrifted {
+		patch.SetContainer(*container)
+		drifted = true
+	}
+
+	if desired.Replicas != live.Replicas {
+		patch.SetReplicas(desired.Replicas)
+		drifted = true
+	}
+	if !unorderedEqual(desired.CountryCodes, live.CountryCodes) {
+		patch.SetCountryCodes(desired.CountryCodes)
+		drifted = true
+	}
+	if desired.Networking != nil && live.Networking != nil && desired.Networking.Port != live.Networking.Port {
+		networking := saladclient.NewUpdateContainerGroupNetworking()
+		networking.SetPort(desired.Networking.Port)
+		patch.SetNetworking(*networking)
+		drifted = true
+	}
+	if desired.LivenessProbe != nil && !reflect.DeepEqual(desired.LivenessProbe, live.LivenessProbe) {
+		patch.SetLivenessProbe(*desired.LivenessProbe)
+		drifted = true
+	}
+	if desired.ReadinessProbe != nil && !reflect.DeepEqual(desired.ReadinessProbe, live.ReadinessProbe) {
+		patch.SetReadinessProbe(*desired.ReadinessProbe)
+		drifted = true
+	}
+	if desired.StartupProbe != nil && !reflect.DeepEqual(desired.StartupProbe, live.StartupProbe) {
+		patch.SetStartupProbe(*desired.StartupProbe)
+		drifted = true
+	}
+
+	return patch, drifted
+}
+
+func environmentEqual(desired, live map[string]string) bool {
+	filter := func(env map[string]string) map[string]string {
+		filtered := make(map[string]string, len(env))
+		for name, value := range env {
+			if slices.Contains(driftIgnoredEnvVars, name) {
+				continue
+			}
+			if _, ok := desired[name]; !ok && serviceLinkEnvVarPattern.MatchString(name) {
+				continue
+			}
+			filtered[name] = value
+		}
+		return filtered
+	}
+	return reflect.DeepEqual(filter(desired), filter(live))
+}
+
+func unorderedEqual[T ~string](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := slices.Clone(a)
+	sortedB := slices.Clone(b)
+	slices.Sort(sortedA)
+	slices.Sort(sortedB)
+	return slices.Equal(sortedA, sortedB)
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_getContainerGroupPatch(t *testing.T) {
+	desired := *saladclient.NewContainerGroupPrototype(
+		true,
+		*saladclient.NewCreateContainer("nginx:1.27", *saladclient.NewContainerResourceRequirements(1, 1024, []string{})),
+		"default-web",
+		int32(1),
+		saladclient.CONTAINERRESTARTPOLICY_ALWAYS,
+	)
+	desired.Container.SetEnvironmentVariables(map[string]string{
+		"POD_METADATA_YAML": `{"resourceVersion":"2"}`,
+		ownerPodUIDEnvVar:   "uid",
+	})
+	live := saladclient.ContainerGroup{
+		Name:     "default-web",
+		Replicas: 1,
+		Container: saladclient.Container{
+			Image:     "nginx:1.27",
+			Resources: *saladclient.NewContainerResourceRequirements(1, 1024, []string{}),
+			EnvironmentVariables: map[string]string{
+				"POD_METADATA_YAML": `{"resourceVersion":"1"}`,
+				ownerPodUIDEnvVar:   "uid",
+			},
+		},
+	}
+
+	// Pod metadata changes alone are not drift
+	_, drifted := getContainerGroupPatch(desired, live)
+	assert.False(t, drifted)
+
+	// Neither are the service links virtual-kubelet added when the container group was created
+	live.Container.EnvironmentVariables["KUBERNETES_SERVICE_HOST"] = "10.0.0.1"
+	live.Container.EnvironmentVariables["KUBERNETES_PORT_443_TCP_ADDR"] = "10.0.0.1"
+	live.Container.EnvironmentVariables["WEB_SERVICE_PORT_HTTP"] = "80"
+	live.Container.EnvironmentVariables["WEB_PORT"] = "tcp://10.0.0.2:80"
+	_, drifted = getContainerGroupPatch(desired, live)
+	assert.False(t, drifted)
+
+	// But variables of the pod that look like them are
+	desired.Container.EnvironmentVariables["WEB_PORT"] = "8080"
+	_, drifted = getContainerGroupPatch(desired, live)
+	assert.True(t, drifted)
+	delete(desired.Container.EnvironmentVariables, "WEB_PORT")
+
+	// Image drift only patches the container image
+	desired.Container.Image = "nginx:1.28"
+	patch, drifted := getContainerGroupPatch(desired, live)
+	assert.True(t, drifted)
+	assert.Equal(t, "nginx:1.28", patch.Container.GetImage())
+	assert.Nil(t, patch.Container.Resources)
+	assert.False(t, patch.Replicas.IsSet())
+}
+
+func Test_UpdatePod(t *testing.T) {
+	defer func(interval time.Duration) { containerGroupDeletionPollInterval = interval }(containerGroupDeletionPollInterval)
+	containerGroupDeletionPollInterval = time.Millisecond
+
+	live := newTestContainerGroup("default-web", "nginx:1.27")
+	var requests []string
+	pendingDeletes := 0
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodDelete:
+			// Deleted after being listed once more
+			pendingDeletes = 2
+			w.WriteHeader(http.StatusAccepted)
+			return
+		case r.Method == http.MethodGet && pendingDeletes == 1:
+			pendingDeletes = 0
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(saladclient.ProblemDetails{})
+			return
+		case r.Method == http.MethodGet && pendingDeletes > 1:
+			pendingDeletes--
+		}
+		_ = json.NewEncoder(w).Encode(live)
+	}))
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyAlways,
+			Containers:    []corev1.Container{{Name: "web", Image: "nginx:1.28", Ports: []corev1.ContainerPort{{ContainerPort: 80}}}},
+		},
+	}
+
+	// Image changes are patched in place
+	require.NoError(t, p.UpdatePod(context.Background(), pod))
+	assert.Equal(t, []string{http.MethodGet, http.MethodPatch}, requests)
+	assert.Contains(t, <-recorder.Events, "ContainerGroupUpdated")
+
+	// Asking for a gateway needs a new container group, created once the old one is gone
+	requests = nil
+	pod.Annotations = map[string]string{networkingAnnotation: "true"}
+	require.NoError(t, p.UpdatePod(context.Background(), pod))
+	assert.Equal(t, []string{http.MethodGet, http.MethodDelete, http.MethodGet, http.MethodGet, http.MethodPost}, requests)
+	assert.Contains(t, <-recorder.Events, "ContainerGroupRecreated")
+
+	// The container group of another pod sharing the name is left alone
+	requests = nil
+	live.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerPodNameEnvVar: "api"}
+	assert.Error(t, p.UpdatePod(context.Background(), pod))
+	assert.Equal(t, []string{http.MethodGet}, requests)
+	assert.Contains(t, <-recorder.Events, "belongs to another pod")
+
+	// And so is one created by another cluster
+	requests = nil
+	live.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerPodNameEnvVar: "web", ownerClusterIDEnvVar: "other-cluster"}
+	assert.Error(t, p.UpdatePod(context.Background(), pod))
+	assert.Equal(t, []string{http.MethodGet}, requests)
+	assert.Contains(t, <-recorder.Events, "belongs to another pod")
+}
+
+func Test_adoptContainerGroup_neverRecreates(t *testing.T) {
+	live := newTestContainerGroup("default-web", "nginx:1.27")
+	var requests []string
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(live)
+	}))
+	recorder := record.NewFakeRecorder(10)
+	p.eventRecorder = recorder
+	live.Container.EnvironmentVariables = map[string]string{ownerPodUIDEnvVar: "uid", ownerClusterIDEnvVar: p.inputVars.ClusterID}
+
+	// Container ports alone do not add a gateway to a container group created without one
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid"},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyAlways,
+			Containers:    []corev1.Container{{Name: "web", Image: "nginx:1.27", Ports: []corev1.ContainerPort{{ContainerPort: 80}}}},
+		},
+	}
+	desired, err := p.getContainerGroupPrototype(context.Background(), pod)
+	require.NoError(t, err)
+	require.NotNil(t, desired.Networking)
+	assert.True(t, p.adoptContainerGroup(context.Background(), pod, desired))
+	assert.NotContains(t, requests, http.MethodDelete)
+	assert.Contains(t, <-recorder.Events, "ContainerGroupUpdated")
+
+	// Changes that take a new container group are only reported
+	requests = nil
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	desired, err = p.getContainerGroupPrototype(context.Background(), pod)
+	require.NoError(t, err)
+	assert.True(t, p.adoptContainerGroup(context.Background(), pod, desired))
+	assert.NotContains(t, requests, http.MethodDelete)
+	assert.NotContains(t, requests, http.MethodPost)
+	assert.Contains(t, <-recorder.Events, "ContainerGroupDrifted")
+}
+
+// newTestContainerGroup returns a running container group with every field the client requires
+func newTestContainerGroup(name, image string) saladclient.ContainerGroup {
+	now := time.Now()
+	state := saladclient.NewContainerGroupState(now, *saladclient.NewContainerGroupInstanceStatusCount(0, 0, 1, 0), now, saladclient.CONTAINERGROUPSTATUS_RUNNING)
+	priority := saladclient.CONTAINERGROUPPRIORITY_HIGH
+	container := saladclient.NewContainer([]string{}, image, *saladclient.NewContainerResourceRequirements(1, 1024, []string{}))
+	return *saladclient.NewContainerGroup(true, *container, []saladclient.CountryCode{}, now, *state, name, "id-"+name, name,
+		"org", false, *saladclient.NewNullableContainerGroupPriority(&priority), "project", 1, saladclient.CONTAINERRESTARTPOLICY_ALWAYS, now, 1)
+}
@@ -0,0 +1,316 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Most instances SaladCloud runs in a container group
+const maxContainerGroupReplicas = 500
+
+// Reason of the conditions of the pods of a ReplicaSet waiting for an instance of its container group
+const replicaSetInstancePendingReason = "InstancePending"
+
+// getReplicaSetOwner returns the ReplicaSet whose pods share a single container group with this
+// pod, or nil when the pod has a container group of its own. Pods returned by GetPods and
+// GetContainerGroupPods for such container groups carry the ReplicaSet label, so that they are
+// deleted the same way.
+func (p *SaladCloudProvider) getReplicaSetOwner(pod *corev1.Pod) *metav1.OwnerReference {
+	if !p.inputVars.ReplicaSetContainerGroups && pod.Labels[ownerReplicaSetLabel] == "" {
+		return nil
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return nil
+	}
+	return owner
+}
+
+// getContainerGroupName returns the name of the container group running the pod
+func (p *SaladCloudProvider) getContainerGroupName(pod *corev1.Pod) string {
+	return p.getContainerGroupNameOf(pod.Namespace, pod.Name, p.getReplicaSetOwner(pod))
+}
+
+// getContainerGroupNameOf returns the name of the container group running the pod with the given
+// namespace, name and ReplicaSet owner
+func (p *SaladCloudProvider) getContainerGroupNameOf(namespace, name string, owner *metav1.OwnerReference) string {
+	if owner != nil {
+		return utils.GetContainerGroupName(namespace, owner.Name)
+	}
+	if containerGroupName, ok := p.legacyNames.get(namespace, name); ok {
+		return containerGroupName
+	}
+	return utils.GetContainerGroupName(namespace, name)
+}
+
+// getReplicaSetOwnerOf looks the pod up to find out whether it shares the container group of its ReplicaSet
+func (p *SaladCloudProvider) getReplicaSetOwnerOf(namespace, name string) *metav1.OwnerReference {
+	if !p.inputVars.ReplicaSetContainerGroups || p.podLister == nil {
+		return nil
+	}
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil
+	}
+	return p.getReplicaSetOwner(pod)
+}
+
+// getContainerGroupReplicaSetUID returns the UID of the ReplicaSet a container group was created for
+func getContainerGroupReplicaSetUID(containerGroup saladclient.ContainerGroup) (string, bool) {
+	uid, ok := containerGroup.Container.EnvironmentVariables[ownerReplicaSetUIDEnvVar]
+	return uid, ok && uid != ""
+}
+
+// isContainerGroupOfReplicaSet guards lookups by name against container groups created for
+// another ReplicaSet or for a pod
+func isContainerGroupOfReplicaSet(containerGroup saladclient.ContainerGroup, owner *metav1.OwnerReference) bool {
+	uid, ok := getContainerGroupReplicaSetUID(containerGroup)
+	return ok && uid == string(owner.UID)
+}
+
+// isContainerGroupOfPod guards lookups by name against container groups created for another pod
+// or ReplicaSet
+func isContainerGroupOfPod(containerGroup saladclient.ContainerGroup, namespace, name string, owner *metav1.OwnerReference) bool {
+	if owner != nil {
+		return isContainerGroupOfReplicaSet(containerGroup, owner)
+	}
+	return isContainerGroupOf(containerGroup, namespace, name)
+}
+
+// getReplicaSetPods returns the pods of the ReplicaSet bound to this node, oldest first, leaving
+// out the terminating ones
+func (p *SaladCloudProvider) getReplicaSetPods(namespace string, owner *metav1.OwnerReference) ([]*corev1.Pod, error) {
+	pods, err := p.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	replicaSetPods := make([]*corev1.Pod, 0)
+	for _, pod := range pods {
+		controller := metav1.GetControllerOf(pod)
+		if pod.DeletionTimestamp != nil || controller == nil || controller.UID != owner.UID {
+			continue
+		}
+		replicaSetPods = append(replicaSetPods, pod)
+	}
+	sort.Slice(replicaSetPods, func(i, j int) bool {
+		a, b := replicaSetPods[i], replicaSetPods[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return replicaSetPods, nil
+}
+
+// getReplicaSetContainerGroupPods expands the pod built from the container group of a ReplicaSet
+// into the pods of the ReplicaSet bound to this node
+func (p *SaladCloudProvider) getReplicaSetContainerGroupPods(containerGroupPod *corev1.Pod, uid string) []*corev1.Pod {
+	if p.podLister == nil {
+		return nil
+	}
+	replicaSetPods, err := p.getReplicaSetPods(containerGroupPod.Namespace, &metav1.OwnerReference{UID: types.UID(uid)})
+	if err != nil {
+		p.logger.WithError(err).Errorf("getReplicaSetContainerGroupPods: failed to list pods of container group %s", containerGroupPod.Spec.Containers[0].Name)
+		return nil
+	}
+	pods := make([]*corev1.Pod, 0, len(replicaSetPods))
+	for _, replicaSetPod := range replicaSetPods {
+		pod := containerGroupPod.DeepCopy()
+		pod.Name = replicaSetPod.Name
+		pod.UID = replicaSetPod.UID
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// getReplicaSetReplicas returns the replica count of the container group of the ReplicaSet, which
+// follows spec.replicas. The pods bound to this node are counted when the ReplicaSet is gone.
+func (p *SaladCloudProvider) getReplicaSetReplicas(ctx context.Context, namespace string, owner *metav1.OwnerReference) (int32, error) {
+	var replicaSet *appsv1.ReplicaSet
+	if p.kubeClient != nil {
+		var err error
+		replicaSet, err = p.kubeClient.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("failed to get replica set %s/%s: %w", namespace, owner.Name, err)
+		}
+	}
+	var replicas int32
+	if replicaSet != nil && replicaSet.UID == owner.UID {
+		replicas = 1
+		if replicaSet.Spec.Replicas != nil {
+			replicas = *replicaSet.Spec.Replicas
+		}
+	} else {
+		pods, err := p.getReplicaSetPods(namespace, owner)
+		if err != nil {
+			return 0, err
+		}
+		replicas = int32(len(pods))
+	}
+	if replicas > maxContainerGroupReplicas {
+		p.logger.Warnf("getReplicaSetReplicas: replica set %s/%s has %d replicas, SaladCloud runs at most %d", namespace, owner.Name, replicas, maxContainerGroupReplicas)
+		replicas = maxContainerGroupReplicas
+	}
+	return replicas, nil
+}
+
+// createReplicaSetPod creates the container group of the ReplicaSet of the pod, or scales the
+// existing one to the replica count of the ReplicaSet
+func (p *SaladCloudProvider) createReplicaSetPod(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference, createContainerGroup saladclient.ContainerGroupPrototype) error {
+	replicas, err := p.getReplicaSetReplicas(ctx, pod.Namespace, owner)
+	if err != nil {
+		return err
+	}
+	live, err := p.getReplicaSetContainerGroup(ctx, pod, owner)
+	if err != nil {
+		return err
+	}
+	if live != nil {
+		if err := p.scaleContainerGroup(ctx, pod, *live, replicas); err != nil {
+			return err
+		}
+		p.setCreatedPodStatus(pod)
+		return nil
+	}
+
+	createContainerGroup.SetReplicas(max(replicas, 1))
+	createCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	_, r, err := p.apiClient.ContainerGroupsAPI.
+		CreateContainerGroup(createCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName).
+		ContainerGroupPrototype(createContainerGroup).
+		Execute()
+	if err != nil {
+		// Another pod of the ReplicaSet may have created it first, the retry scales it instead
+		p.logger.WithError(err).Errorf("createReplicaSetPod: failed to create container group %s for pod %s", createContainerGroup.Name, pod.Name)
+		return models.NewSaladCloudError(err, r)
+	}
+	p.lifecycle.created(createContainerGroup.Name)
+	p.instances.forget(createContainerGroup.Name)
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupCreated, "Created container group %s with %d replicas for replica set %s", createContainerGroup.Name, createContainerGroup.Replicas, owner.Name)
+	p.setCreatedPodStatus(pod)
+	return nil
+}
+
+// deleteReplicaSetPod scales the container group of the ReplicaSet of the pod to the replica count
+// of the ReplicaSet. It returns false when the pod is the last one of the ReplicaSet bound to this
+// node, and the container group goes away with it.
+func (p *SaladCloudProvider) deleteReplicaSetPod(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference) (bool, error) {
+	pods, err := p.getReplicaSetPods(pod.Namespace, owner)
+	if err != nil {
+		return false, err
+	}
+	remaining := 0
+	for _, replicaSetPod := range pods {
+		if replicaSetPod.UID != pod.UID {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return false, nil
+	}
+
+	return true, p.syncReplicaSetReplicas(ctx, pod, owner)
+}
+
+// syncReplicaSetReplicas scales the container group of the ReplicaSet of the pod to the replica
+// count of the ReplicaSet. The spec of the container group is left alone, as changes to the pod
+// template of a Deployment roll out as a new ReplicaSet.
+func (p *SaladCloudProvider) syncReplicaSetReplicas(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference) error {
+	live, err := p.getReplicaSetContainerGroup(ctx, pod, owner)
+	if err != nil || live == nil {
+		return err
+	}
+	replicas, err := p.getReplicaSetReplicas(ctx, pod.Namespace, owner)
+	if err != nil {
+		return err
+	}
+	return p.scaleContainerGroup(ctx, pod, *live, replicas)
+}
+
+// getReplicaSetContainerGroup returns the container group of the ReplicaSet, or nil when there is none
+func (p *SaladCloudProvider) getReplicaSetContainerGroup(ctx context.Context, pod *corev1.Pod, owner *metav1.OwnerReference) (*saladclient.ContainerGroup, error) {
+	containerGroupName := p.getContainerGroupName(pod)
+	getCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	containerGroup, r, err := p.apiClient.ContainerGroupsAPI.GetContainerGroup(getCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroupName).Execute()
+	if err != nil {
+		if r != nil && r.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, models.NewSaladCloudError(err, r)
+	}
+	if !isContainerGroupOfReplicaSet(*containerGroup, owner) || containerGroup.Container.EnvironmentVariables[ownerClusterIDEnvVar] != p.inputVars.ClusterID {
+		return nil, fmt.Errorf("container group %s belongs to another workload", containerGroupName)
+	}
+	return containerGroup, nil
+}
+
+// scaleContainerGroup sets the replica count of the container group. A ReplicaSet scaled to zero
+// keeps its container group, with zero replicas, until its last pod is deleted.
+func (p *SaladCloudProvider) scaleContainerGroup(ctx context.Context, pod *corev1.Pod, live saladclient.ContainerGroup, replicas int32) error {
+	if live.Replicas == replicas {
+		return nil
+	}
+	patch := saladclient.NewContainerGroupPatch()
+	patch.SetReplicas(replicas)
+	updateCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIWriteTimeout)
+	defer cancel()
+	_, r, err := p.apiClient.ContainerGroupsAPI.
+		UpdateContainerGroup(updateCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, live.Name).
+		ContainerGroupPatch(*patch).
+		Execute()
+	if err != nil {
+		p.eventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonContainerGroupUpdateFailed, "Failed to scale container group %s to %d replicas: %v", live.Name, replicas, err)
+		return models.NewSaladCloudError(err, r)
+	}
+	p.eventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonContainerGroupScaled, "Scaled container group %s from %d to %d replicas", live.Name, live.Replicas, replicas)
+	return nil
+}
+
+// projectReplicaSetPodStatus projects the pods of a ReplicaSet onto the running instances of its
+// container group: the oldest pods are the ready ones, the others keep their phase but are not
+// ready until there is an instance for them
+func (p *SaladCloudProvider) projectReplicaSetPodStatus(namespace, name string, owner *metav1.OwnerReference, containerGroup *saladclient.ContainerGroup, status *corev1.PodStatus) {
+	if status.Phase != corev1.PodRunning {
+		return
+	}
+	pods, err := p.getReplicaSetPods(namespace, owner)
+	if err != nil {
+		return
+	}
+	index := -1
+	for i, pod := range pods {
+		if pod.Name == name {
+			index = i
+			break
+		}
+	}
+	if index >= 0 && index < int(containerGroup.CurrentState.InstanceStatusCounts.RunningCount) {
+		return
+	}
+
+	message := fmt.Sprintf("Waiting for an instance of container group %s", containerGroup.Name)
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == corev1.PodReady || status.Conditions[i].Type == corev1.ContainersReady {
+			status.Conditions[i].Status = corev1.ConditionFalse
+			status.Conditions[i].Reason = replicaSetInstancePendingReason
+			status.Conditions[i].Message = message
+		}
+	}
+	for i := range status.ContainerStatuses {
+		status.ContainerStatuses[i].Ready = false
+	}
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newReplicaSetPod returns a pod of the "api" ReplicaSet with the given UID
+func newReplicaSetPod(name string, replicaSetUID types.UID) *corev1.Pod {
+	controller := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			UID:               types.UID("uid-" + name),
+			CreationTimestamp: metav1.NewTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "api", UID: replicaSetUID, Controller: &controller,
+			}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "api", Image: "api:1"}}},
+	}
+}
+
+func newTestReplicaSet(replicas int32) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", UID: "rs-uid"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+}
+
+func Test_getReplicaSetOwner(t *testing.T) {
+	p, _ := newProvider()
+	pod := newReplicaSetPod("api-1", "rs-uid")
+
+	// Opt-in
+	assert.Nil(t, p.getReplicaSetOwner(pod))
+	assert.Equal(t, utils.GetContainerGroupName("default", "api-1"), p.getContainerGroupName(pod))
+
+	p.inputVars.ReplicaSetContainerGroups = true
+	assert.Equal(t, utils.GetContainerGroupName("default", "api"), p.getContainerGroupName(pod))
+	env := p.getOwnershipEnvironment(pod)
+	assert.Equal(t, "rs-uid", env[ownerReplicaSetUIDEnvVar])
+	assert.NotContains(t, env, ownerPodNameEnvVar)
+
+	// Pods built from the shared container group stand for the ReplicaSet
+	containerGroup := newTestContainerGroup(p.getContainerGroupName(pod), "api:1")
+	containerGroup.Container.EnvironmentVariables = env
+	providerPod := &corev1.Pod{}
+	setOwnershipMetadata(providerPod, containerGroup)
+	assert.Equal(t, "rs-uid", providerPod.Labels[ownerReplicaSetLabel])
+	p.inputVars.ReplicaSetContainerGroups = false
+	assert.Equal(t, utils.GetContainerGroupName("default", "api"), p.getContainerGroupName(providerPod))
+}
+
+func Test_projectReplicaSetPodStatus(t *testing.T) {
+	p, _ := newProvider()
+	p.inputVars.ReplicaSetContainerGroups = true
+	pods := []*corev1.Pod{newReplicaSetPod("api-1", "rs-uid"), newReplicaSetPod("api-2", "rs-uid"), newReplicaSetPod("api-3", "rs-uid")}
+	pods[2].CreationTimestamp = metav1.NewTime(pods[2].CreationTimestamp.Add(time.Minute))
+	p.podLister = newTestPodLister(pods...)
+	containerGroup := newTestContainerGroup(p.getContainerGroupName(pods[0]), "api:1")
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(3, 0, 2, 0)
+
+	phases := make(map[string]corev1.PodPhase)
+	ready := make(map[string]corev1.ConditionStatus)
+	for _, pod := range pods {
+		status := p.podStatusFromContainerGroup(pod.Namespace, pod.Name, &containerGroup)
+		p.projectReplicaSetPodStatus(pod.Namespace, pod.Name, p.getReplicaSetOwner(pod), &containerGroup, status)
+		phases[pod.Name] = status.Phase
+		condition, _ := getPodCondition(status.Conditions, corev1.PodReady)
+		ready[pod.Name] = condition.Status
+	}
+	// The newest pod waits for a third running instance, without going back to Pending
+	assert.Equal(t, map[string]corev1.PodPhase{"api-1": corev1.PodRunning, "api-2": corev1.PodRunning, "api-3": corev1.PodRunning}, phases)
+	assert.Equal(t, map[string]corev1.ConditionStatus{"api-1": corev1.ConditionTrue, "api-2": corev1.ConditionTrue, "api-3": corev1.ConditionFalse}, ready)
+}
+
+func Test_createReplicaSetPod(t *testing.T) {
+	var live *saladclient.ContainerGroup
+	var patches []saladclient.ContainerGroupPatch
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost:
+			var prototype saladclient.ContainerGroupPrototype
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&prototype))
+			containerGroup := newTestContainerGroup(prototype.Name, prototype.Container.Image)
+			containerGroup.Replicas = prototype.Replicas
+			containerGroup.Container.EnvironmentVariables = prototype.Container.EnvironmentVariables
+			live = &containerGroup
+			_ = json.NewEncoder(w).Encode(live)
+		case r.Method == http.MethodPatch:
+			var patch saladclient.ContainerGroupPatch
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			patches = append(patches, patch)
+			live.Replicas = *patch.Replicas.Get()
+			_ = json.NewEncoder(w).Encode(live)
+		case live != nil && strings.HasSuffix(r.URL.Path, "/"+live.Name):
+			_ = json.NewEncoder(w).Encode(live)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(saladclient.ProblemDetails{})
+		}
+	}))
+	p.inputVars.ReplicaSetContainerGroups = true
+	pods := []*corev1.Pod{newReplicaSetPod("api-1", "rs-uid"), newReplicaSetPod("api-2", "rs-uid")}
+	p.podLister = newTestPodLister(pods...)
+	p.kubeClient = fake.NewSimpleClientset(newTestReplicaSet(3))
+
+	// The first pod creates the container group with the replicas of the ReplicaSet
+	require.NoError(t, p.CreatePod(context.Background(), pods[0]))
+	require.NotNil(t, live)
+	assert.Equal(t, int32(3), live.Replicas)
+	assert.Empty(t, patches)
+
+	// The others join it, and it follows the ReplicaSet when it scales
+	_, err := p.kubeClient.AppsV1().ReplicaSets("default").Update(context.Background(), newTestReplicaSet(2), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, p.CreatePod(context.Background(), pods[1]))
+	assert.Equal(t, int32(2), live.Replicas)
+	assert.Equal(t, corev1.PodPending, pods[1].Status.Phase)
+
+	// The container group outlives all but the last pod of the ReplicaSet
+	shared, err := p.deleteReplicaSetPod(context.Background(), pods[0], p.getReplicaSetOwner(pods[0]))
+	require.NoError(t, err)
+	assert.True(t, shared)
+	p.podLister = newTestPodLister(pods[1])
+	shared, err = p.deleteReplicaSetPod(context.Background(), pods[1], p.getReplicaSetOwner(pods[1]))
+	require.NoError(t, err)
+	assert.False(t, shared)
+}
@@ -0,0 +1,312 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// How long the last container group listing is reused for stats before the API is asked again
+var statsSnapshotMaxAge = 30 * time.Second
+
+// containerGroupsSnapshot keeps the last container group listing, so that stats scrapes do not
+// add API calls on top of the pod status polling
+type containerGroupsSnapshot struct {
+	mu    sync.Mutex
+	items []saladclient.ContainerGroup
+	time  time.Time
+}
+
+func (s *containerGroupsSnapshot) set(items []saladclient.ContainerGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = items
+	s.time = time.Now()
+}
+
+func (s *containerGroupsSnapshot) get(maxAge time.Duration) ([]saladclient.ContainerGroup, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.time.IsZero() || time.Since(s.time) > maxAge {
+		return nil, false
+	}
+	return s.items, true
+}
+
+// podAllocation is what SaladCloud tells about the resources of a pod. SaladCloud does not report
+// live usage, so the CPU and memory reported as usage are what the running instances have been
+// allocated, which keeps kubectl top working but always shows pods using all of their requests.
+// The allocations are exported under their own saladcloud_* names too.
+type podAllocation struct {
+	namespace  string
+	name       string
+	uid        string
+	container  string
+	startTime  time.Time
+	cpuCores   int64
+	memoryMiB  int64
+	running    int32
+	allocating int32
+	creating   int32
+	stopping   int32
+}
+
+// allocatedCores is the CPU of the running instances
+func (a podAllocation) allocatedCores() float64 {
+	return float64(a.cpuCores) * float64(a.running)
+}
+
+// allocatedBytes is the memory of the running instances
+func (a podAllocation) allocatedBytes() float64 {
+	return float64(a.memoryMiB) * float64(a.running) * 1024 * 1024
+}
+
+// allocatedCPUSeconds is the CPU time allocated to the running instances since the container group
+// started running
+func (a podAllocation) allocatedCPUSeconds(now time.Time) float64 {
+	if a.running == 0 || a.startTime.IsZero() || now.Before(a.startTime) {
+		return 0
+	}
+	return a.allocatedCores() * now.Sub(a.startTime).Seconds()
+}
+
+// instanceCount is the number of instances of a pod in a state
+type instanceCount struct {
+	state string
+	value int32
+}
+
+// instanceCounts returns the instances of the pod in every state, always in the same order
+func (a podAllocation) instanceCounts() [4]instanceCount {
+	return [4]instanceCount{
+		{"allocating", a.allocating},
+		{"creating", a.creating},
+		{"running", a.running},
+		{"stopping", a.stopping},
+	}
+}
+
+// getPodAllocations returns the allocation of every pod of this node that has a container group
+func (p *SaladCloudProvider) getPodAllocations(ctx context.Context) ([]podAllocation, error) {
+	containerGroups, ok := p.containerGroups.get(statsSnapshotMaxAge)
+	if !ok {
+		var err error
+		if containerGroups, err = p.listContainerGroups(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if p.podLister == nil {
+		return nil, nil
+	}
+
+	allocations := make([]podAllocation, 0, len(containerGroups))
+	for i := range containerGroups {
+		containerGroup := &containerGroups[i]
+		env := containerGroup.Container.EnvironmentVariables
+		if uid, ok := getContainerGroupReplicaSetUID(*containerGroup); ok {
+			allocations = append(allocations, p.getReplicaSetPodAllocations(env[ownerPodNamespaceEnvVar], uid, containerGroup)...)
+			continue
+		}
+		if _, ok := getContainerGroupPodKey(*containerGroup); !ok {
+			continue
+		}
+		pod, err := p.podLister.Pods(env[ownerPodNamespaceEnvVar]).Get(env[ownerPodNameEnvVar])
+		if err != nil {
+			// Not a pod of this node
+			continue
+		}
+		counts := containerGroup.CurrentState.InstanceStatusCounts
+		allocations = append(allocations, p.newPodAllocation(pod, containerGroup, counts))
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		return getPodKey(allocations[i].namespace, allocations[i].name) < getPodKey(allocations[j].namespace, allocations[j].name)
+	})
+	return allocations, nil
+}
+
+// getReplicaSetPodAllocations spreads the instances of the container group of a ReplicaSet over its
+// pods: the oldest pods get the running instances, like in their statuses, the next ones those
+// being created, then those being allocated
+func (p *SaladCloudProvider) getReplicaSetPodAllocations(namespace, uid string, containerGroup *saladclient.ContainerGroup) []podAllocation {
+	pods, err := p.getReplicaSetPods(namespace, &metav1.OwnerReference{UID: types.UID(uid)})
+	if err != nil {
+		return nil
+	}
+	counts := containerGroup.CurrentState.InstanceStatusCounts
+	allocations := make([]podAllocation, 0, len(pods))
+	for i, pod := range pods {
+		var podCounts saladclient.ContainerGroupInstanceStatusCount
+		switch index := int32(i); {
+		case index < counts.RunningCount:
+			podCounts.RunningCount = 1
+		case index < counts.RunningCount+counts.CreatingCount:
+			podCounts.CreatingCount = 1
+		case index < counts.RunningCount+counts.CreatingCount+counts.AllocatingCount:
+			podCounts.AllocatingCount = 1
+		}
+		allocations = append(allocations, p.newPodAllocation(pod, containerGroup, podCounts))
+	}
+	return allocations
+}
+
+func (p *SaladCloudProvider) newPodAllocation(pod *corev1.Pod, containerGroup *saladclient.ContainerGroup, counts saladclient.ContainerGroupInstanceStatusCount) podAllocation {
+	containerName := containerGroup.Name
+	if mainContainer, err := p.getMainContainer(pod); err == nil {
+		containerName = mainContainer.Name
+	}
+	return podAllocation{
+		namespace:  pod.Namespace,
+		name:       pod.Name,
+		uid:        string(pod.UID),
+		container:  containerName,
+		startTime:  containerGroup.CurrentState.StartTime,
+		cpuCores:   int64(containerGroup.Container.Resources.Cpu),
+		memoryMiB:  int64(containerGroup.Container.Resources.Memory),
+		running:    counts.RunningCount,
+		allocating: counts.AllocatingCount,
+		creating:   counts.CreatingCount,
+		stopping:   counts.StoppingCount,
+	}
+}
+
+// GetStatsSummary reports the CPU and memory allocated to the running instances of the pods of the
+// node, and their totals for the node, as their usage
+func (p *SaladCloudProvider) GetStatsSummary(ctx context.Context) (*stats.Summary, error) {
+	ctx, span := trace.StartSpan(ctx, "GetStatsSummary")
+	defer span.End()
+
+	allocations, err := p.getPodAllocations(ctx)
+	if err != nil {
+		span.SetStatus(err)
+		return nil, err
+	}
+	now := time.Now()
+	timestamp := metav1.NewTime(now)
+	summary := &stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  p.inputVars.NodeName,
+			StartTime: metav1.NewTime(p.startTime),
+		},
+		Pods: make([]stats.PodStats, 0, len(allocations)),
+	}
+
+	var nodeNanoCores, nodeBytes, nodeCoreNanoSeconds uint64
+	for _, allocation := range allocations {
+		nanoCores := uint64(allocation.allocatedCores() * float64(time.Second))
+		bytes := uint64(allocation.allocatedBytes())
+		coreNanoSeconds := uint64(allocation.allocatedCPUSeconds(now) * float64(time.Second))
+		nodeNanoCores += nanoCores
+		nodeBytes += bytes
+		nodeCoreNanoSeconds += coreNanoSeconds
+
+		startTime := metav1.NewTime(allocation.startTime)
+		cpu := &stats.CPUStats{Time: timestamp, UsageNanoCores: &nanoCores, UsageCoreNanoSeconds: &coreNanoSeconds}
+		memory := &stats.MemoryStats{Time: timestamp, UsageBytes: &bytes, WorkingSetBytes: &bytes}
+		summary.Pods = append(summary.Pods, stats.PodStats{
+			PodRef:     stats.PodReference{Namespace: allocation.namespace, Name: allocation.name, UID: allocation.uid},
+			StartTime:  startTime,
+			Containers: []stats.ContainerStats{{Name: allocation.container, StartTime: startTime, CPU: cpu, Memory: memory}},
+			CPU:        cpu,
+			Memory:     memory,
+		})
+	}
+	summary.Node.CPU = &stats.CPUStats{Time: timestamp, UsageNanoCores: &nodeNanoCores, UsageCoreNanoSeconds: &nodeCoreNanoSeconds}
+	summary.Node.Memory = &stats.MemoryStats{Time: timestamp, UsageBytes: &nodeBytes, WorkingSetBytes: &nodeBytes}
+	return summary, nil
+}
+
+// GetMetricsResource exports the resource metrics read by kubectl top, from the CPU and memory
+// allocated to the running instances, along with the allocations and instance counts of the pods
+// and their totals for the node
+func (p *SaladCloudProvider) GetMetricsResource(ctx context.Context) ([]*dto.MetricFamily, error) {
+	ctx, span := trace.StartSpan(ctx, "GetMetricsResource")
+	defer span.End()
+
+	allocations, err := p.getPodAllocations(ctx)
+	if err != nil {
+		span.SetStatus(err)
+		return nil, err
+	}
+	now := time.Now()
+	timestamp := now.UnixMilli()
+	nodeCPU := newMetricFamily("node_cpu_usage_seconds_total", "Cumulative CPU time allocated to running SaladCloud instances", dto.MetricType_COUNTER)
+	nodeMemory := newMetricFamily("node_memory_working_set_bytes", "Memory allocated to running SaladCloud instances", dto.MetricType_GAUGE)
+	podCPU := newMetricFamily("pod_cpu_usage_seconds_total", "Cumulative CPU time allocated to the running instances of the pod", dto.MetricType_COUNTER)
+	podMemory := newMetricFamily("pod_memory_working_set_bytes", "Memory allocated to the running instances of the pod", dto.MetricType_GAUGE)
+	containerCPU := newMetricFamily("container_cpu_usage_seconds_total", "Cumulative CPU time allocated to the running instances of the container", dto.MetricType_COUNTER)
+	containerMemory := newMetricFamily("container_memory_working_set_bytes", "Memory allocated to the running instances of the container", dto.MetricType_GAUGE)
+	nodeCPUAllocated := newMetricFamily("saladcloud_node_cpu_allocated_cores", "CPU cores allocated to the running SaladCloud instances of the node", dto.MetricType_GAUGE)
+	nodeMemoryAllocated := newMetricFamily("saladcloud_node_memory_allocated_bytes", "Memory allocated to the running SaladCloud instances of the node", dto.MetricType_GAUGE)
+	nodeInstances := newMetricFamily("saladcloud_node_instances", "SaladCloud instances of the container groups of the node by state", dto.MetricType_GAUGE)
+	podCPUAllocated := newMetricFamily("saladcloud_pod_cpu_allocated_cores", "CPU cores allocated to the running SaladCloud instances of the pod", dto.MetricType_GAUGE)
+	podMemoryAllocated := newMetricFamily("saladcloud_pod_memory_allocated_bytes", "Memory allocated to the running SaladCloud instances of the pod", dto.MetricType_GAUGE)
+	instances := newMetricFamily("saladcloud_container_group_instances", "SaladCloud instances of the container group of the pod by state", dto.MetricType_GAUGE)
+
+	var nodeCPUSeconds, nodeCores, nodeBytes float64
+	var nodeCounts [4]int32
+	for _, allocation := range allocations {
+		cpuSeconds := allocation.allocatedCPUSeconds(now)
+		cores := allocation.allocatedCores()
+		bytes := allocation.allocatedBytes()
+		nodeCPUSeconds += cpuSeconds
+		nodeCores += cores
+		nodeBytes += bytes
+
+		podLabels := newLabelPairs("namespace", allocation.namespace, "pod", allocation.name)
+		containerLabels := newLabelPairs("container", allocation.container, "namespace", allocation.namespace, "pod", allocation.name)
+		addMetric(podCPU, podLabels, cpuSeconds, timestamp)
+		addMetric(podMemory, podLabels, bytes, timestamp)
+		addMetric(containerCPU, containerLabels, cpuSeconds, timestamp)
+		addMetric(containerMemory, containerLabels, bytes, timestamp)
+		addMetric(podCPUAllocated, podLabels, cores, timestamp)
+		addMetric(podMemoryAllocated, podLabels, bytes, timestamp)
+		for i, count := range allocation.instanceCounts() {
+			nodeCounts[i] += count.value
+			addMetric(instances, newLabelPairs("namespace", allocation.namespace, "pod", allocation.name, "state", count.state), float64(count.value), timestamp)
+		}
+	}
+	addMetric(nodeCPU, nil, nodeCPUSeconds, timestamp)
+	addMetric(nodeMemory, nil, nodeBytes, timestamp)
+	addMetric(nodeCPUAllocated, nil, nodeCores, timestamp)
+	addMetric(nodeMemoryAllocated, nil, nodeBytes, timestamp)
+	for i, count := range (podAllocation{}).instanceCounts() {
+		addMetric(nodeInstances, newLabelPairs("state", count.state), float64(nodeCounts[i]), timestamp)
+	}
+
+	return []*dto.MetricFamily{
+		nodeCPU, nodeMemory, podCPU, podMemory, containerCPU, containerMemory,
+		nodeCPUAllocated, nodeMemoryAllocated, nodeInstances, podCPUAllocated, podMemoryAllocated, instances,
+	}, nil
+}
+
+func newMetricFamily(name, help string, metricType dto.MetricType) *dto.MetricFamily {
+	return &dto.MetricFamily{Name: &name, Help: &help, Type: &metricType}
+}
+
+// newLabelPairs builds label pairs from alternating names and values
+func newLabelPairs(namesAndValues ...string) []*dto.LabelPair {
+	labels := make([]*dto.LabelPair, 0, len(namesAndValues)/2)
+	for i := 0; i+1 < len(namesAndValues); i += 2 {
+		labels = append(labels, &dto.LabelPair{Name: &namesAndValues[i], Value: &namesAndValues[i+1]})
+	}
+	return labels
+}
+
+func addMetric(family *dto.MetricFamily, labels []*dto.LabelPair, value float64, timestamp int64) {
+	metric := &dto.Metric{Label: labels, TimestampMs: &timestamp}
+	if family.GetType() == dto.MetricType_COUNTER {
+		metric.Counter = &dto.Counter{Value: &value}
+	} else {
+		metric.Gauge = &dto.Gauge{Value: &value}
+	}
+	family.Metric = append(family.Metric, metric)
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newStatsTestProvider(t *testing.T) (*SaladCloudProvider, *int) {
+	containerGroup := newTestContainerGroup("default-web", "nginx")
+	containerGroup.Container.Resources.Cpu = 2
+	containerGroup.Container.Resources.Memory = 1024
+	containerGroup.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerPodNameEnvVar: "web"}
+	containerGroup.CurrentState.StartTime = time.Now().Add(-10 * time.Second)
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(1, 0, 2, 0)
+	// Container groups without a pod of this node are left out
+	other := newTestContainerGroup("other", "nginx")
+
+	calls := 0
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(saladclient.NewContainerGroupCollection([]saladclient.ContainerGroup{containerGroup, other}))
+	}))
+	p.podLister = newTestPodLister(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx"}}},
+	})
+	return p, &calls
+}
+
+func Test_GetStatsSummary(t *testing.T) {
+	p, calls := newStatsTestProvider(t)
+
+	summary, err := p.GetStatsSummary(context.Background())
+	require.NoError(t, err)
+	require.Len(t, summary.Pods, 1)
+	pod := summary.Pods[0]
+	assert.Equal(t, "uid", pod.PodRef.UID)
+	require.Len(t, pod.Containers, 1)
+	assert.Equal(t, "nginx", pod.Containers[0].Name)
+	// SaladCloud does not report usage, the allocations of the running instances stand for it
+	require.NotNil(t, pod.CPU)
+	assert.Equal(t, uint64(4*time.Second), *pod.CPU.UsageNanoCores)
+	assert.Equal(t, uint64(2*1024*1024*1024), *pod.Memory.WorkingSetBytes)
+	assert.Equal(t, pod.CPU, pod.Containers[0].CPU)
+	require.NotNil(t, summary.Node.CPU)
+	assert.Equal(t, uint64(4*time.Second), *summary.Node.CPU.UsageNanoCores)
+	assert.Greater(t, *summary.Node.CPU.UsageCoreNanoSeconds, uint64(0))
+	assert.Equal(t, uint64(2*1024*1024*1024), *summary.Node.Memory.WorkingSetBytes)
+
+	// The listing is reused while it is fresh
+	_, err = p.GetStatsSummary(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, *calls)
+}
+
+func Test_GetMetricsResource(t *testing.T) {
+	p, _ := newStatsTestProvider(t)
+
+	families, err := p.GetMetricsResource(context.Background())
+	require.NoError(t, err)
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	for name, metrics := range map[string]int{
+		"node_cpu_usage_seconds_total":           1,
+		"node_memory_working_set_bytes":          1,
+		"pod_cpu_usage_seconds_total":            1,
+		"pod_memory_working_set_bytes":           1,
+		"container_cpu_usage_seconds_total":      1,
+		"container_memory_working_set_bytes":     1,
+		"saladcloud_node_cpu_allocated_cores":    1,
+		"saladcloud_node_memory_allocated_bytes": 1,
+		"saladcloud_node_instances":              4,
+		"saladcloud_pod_cpu_allocated_cores":     1,
+		"saladcloud_pod_memory_allocated_bytes":  1,
+		"saladcloud_container_group_instances":   4,
+	} {
+		require.Contains(t, byName, name)
+		assert.Len(t, byName[name].GetMetric(), metrics, name)
+	}
+	assert.Len(t, families, 12)
+	assert.Equal(t, float64(4), byName["saladcloud_pod_cpu_allocated_cores"].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, float64(4), byName["saladcloud_node_cpu_allocated_cores"].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, float64(2*1024*1024*1024), byName["node_memory_working_set_bytes"].GetMetric()[0].GetGauge().GetValue())
+	assert.Greater(t, byName["node_cpu_usage_seconds_total"].GetMetric()[0].GetCounter().GetValue(), float64(0))
+
+	for _, name := range []string{"saladcloud_container_group_instances", "saladcloud_node_instances"} {
+		counts := make(map[string]float64)
+		for _, metric := range byName[name].GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "state" {
+					counts[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+		assert.Equal(t, map[string]float64{"allocating": 1, "creating": 0, "running": 2, "stopping": 0}, counts, name)
+	}
+}
+
+func Test_getPodAllocations_replicaSet(t *testing.T) {
+	p, _ := newProvider()
+	pods := []*corev1.Pod{newReplicaSetPod("api-1", "rs-uid"), newReplicaSetPod("api-2", "rs-uid"), newReplicaSetPod("api-3", "rs-uid")}
+	pods[2].CreationTimestamp = metav1.NewTime(pods[2].CreationTimestamp.Add(time.Minute))
+	p.podLister = newTestPodLister(pods...)
+	containerGroup := newTestContainerGroup("default-api", "api:1")
+	containerGroup.Container.EnvironmentVariables = map[string]string{ownerPodNamespaceEnvVar: "default", ownerReplicaSetUIDEnvVar: "rs-uid"}
+	containerGroup.CurrentState.InstanceStatusCounts = *saladclient.NewContainerGroupInstanceStatusCount(0, 1, 2, 0)
+	p.containerGroups.set([]saladclient.ContainerGroup{containerGroup})
+
+	// Every pod of the ReplicaSet gets stats, with one instance each
+	allocations, err := p.getPodAllocations(context.Background())
+	require.NoError(t, err)
+	require.Len(t, allocations, 3)
+	assert.Equal(t, int32(1), allocations[0].running)
+	assert.Equal(t, int32(1), allocations[1].running)
+	assert.Equal(t, int32(0), allocations[2].running)
+	assert.Equal(t, int32(1), allocations[2].creating)
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Containers that failed this recently and are not running again are backing off, as the
+// kubelet caps its restart back-off at five minutes
+const crashLoopBackOffWindow = 5 * time.Minute
+
+// Exit code reported when the workload error does not tell it
+const unknownExitCode = 1
+
+const (
+	terminationReasonError     = "Error"
+	terminationReasonOOMKilled = "OOMKilled"
+	crashLoopBackOffReason     = "CrashLoopBackOff"
+)
+
+// Exit codes as SaladCloud words them in workload errors, "exited with code 137" or "exit status 1"
+var exitCodePattern = regexp.MustCompile(`(?i)exit(?:ed)?(?: with)?(?: status| code)?[\s:=]*(-?\d+)`)
+
+// getWorkloadErrors lists the failures of the instances of a container group
+func (p *SaladCloudProvider) getWorkloadErrors(ctx context.Context, containerGroupName string) ([]saladclient.WorkloadError, error) {
+	listCtx, cancel := p.contextWithAuth(ctx, p.inputVars.APIReadTimeout)
+	defer cancel()
+	workloadErrors, r, err := p.apiClient.WorkloadErrorsAPI.GetWorkloadErrors(listCtx, p.inputVars.OrganizationName, p.inputVars.ProjectName, containerGroupName).Execute()
+	if err != nil {
+		return nil, models.NewSaladCloudError(err, r)
+	}
+	if workloadErrors.Items == nil {
+		return []saladclient.WorkloadError{}, nil
+	}
+	return workloadErrors.Items, nil
+}
+
+// getPodTerminations returns the failures of the instances of the pod, oldest first. Pods sharing
+// the container group of their ReplicaSet only own the failures of their instance.
+func getPodTerminations(workloadErrors []saladclient.WorkloadError, owner *metav1.OwnerReference, instance *saladclient.ContainerGroupInstance) []saladclient.WorkloadError {
+	terminations := make([]saladclient.WorkloadError, 0, len(workloadErrors))
+	for _, workloadError := range workloadErrors {
+		if owner != nil && (instance == nil || workloadError.InstanceId != instance.Id) {
+			continue
+		}
+		terminations = append(terminations, workloadError)
+	}
+	sort.SliceStable(terminations, func(i, j int) bool {
+		return terminations[i].FailedAt.Before(terminations[j].FailedAt)
+	})
+	return terminations
+}
+
+// getTerminatedState maps a workload error to the state of the container it terminated
+func getTerminatedState(workloadError saladclient.WorkloadError) *corev1.ContainerStateTerminated {
+	exitCode := int32(unknownExitCode)
+	if match := exitCodePattern.FindStringSubmatch(workloadError.Detail); match != nil {
+		if code, err := strconv.ParseInt(match[1], 10, 32); err == nil {
+			exitCode = int32(code)
+		}
+	}
+	reason := terminationReasonError
+	detail := strings.ToLower(workloadError.Detail)
+	if strings.Contains(detail, "out of memory") || strings.Contains(detail, "oom") {
+		reason = terminationReasonOOMKilled
+	}
+	startedAt := workloadError.AllocatedAt
+	if workloadError.StartedAt != nil {
+		startedAt = *workloadError.StartedAt
+	}
+	return &corev1.ContainerStateTerminated{
+		ExitCode:   exitCode,
+		Reason:     reason,
+		Message:    fmt.Sprintf("Instance %s on machine %s: %s", workloadError.InstanceId, workloadError.MachineId, workloadError.Detail),
+		StartedAt:  metav1.NewTime(startedAt),
+		FinishedAt: metav1.NewTime(workloadError.FailedAt),
+	}
+}
+
+// setTerminationStatus records the failures of the instances of a pod on the status of its main
+// container: the last one is the state of the container of a failed container group, otherwise
+// its last termination, and the container is backing off while it has not run again since.
+func setTerminationStatus(containerStatus *corev1.ContainerStatus, groupStatus saladclient.ContainerGroupStatus, terminations []saladclient.WorkloadError, now time.Time) {
+	if len(terminations) == 0 {
+		return
+	}
+	last := terminations[len(terminations)-1]
+	if groupStatus == saladclient.CONTAINERGROUPSTATUS_FAILED {
+		containerStatus.Ready = false
+		containerStatus.State = corev1.ContainerState{Terminated: getTerminatedState(last)}
+		if len(terminations) > 1 {
+			containerStatus.LastTerminationState = corev1.ContainerState{Terminated: getTerminatedState(terminations[len(terminations)-2])}
+		}
+		return
+	}
+
+	containerStatus.LastTerminationState = corev1.ContainerState{Terminated: getTerminatedState(last)}
+	if containerStatus.State.Running == nil && now.Sub(last.FailedAt) < crashLoopBackOffWindow {
+		containerStatus.State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+			Reason:  crashLoopBackOffReason,
+			Message: fmt.Sprintf("back-off restarting failed container %s: %s", containerStatus.Name, last.Detail),
+		}}
+	}
+}
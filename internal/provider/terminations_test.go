@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	saladclient "github.com/SaladTechnologies/salad-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestWorkloadError(instanceID, detail string, failedAt time.Time) saladclient.WorkloadError {
+	return *saladclient.NewWorkloadError(failedAt.Add(-time.Hour), detail, failedAt, instanceID, "machine-"+instanceID, 1)
+}
+
+func Test_getTerminatedState(t *testing.T) {
+	failedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for detail, expected := range map[string]struct {
+		exitCode int32
+		reason   string
+	}{
+		"Container exited with code 2":        {2, terminationReasonError},
+		"exit status 137: container was OOM":  {137, terminationReasonOOMKilled},
+		"Process ran out of memory":           {unknownExitCode, terminationReasonOOMKilled},
+		"Failed to pull image":                {unknownExitCode, terminationReasonError},
+		"Container exited with exit code: 42": {42, terminationReasonError},
+	} {
+		terminated := getTerminatedState(newTestWorkloadError("a", detail, failedAt))
+		assert.Equal(t, expected.exitCode, terminated.ExitCode, detail)
+		assert.Equal(t, expected.reason, terminated.Reason, detail)
+		assert.Equal(t, metav1.NewTime(failedAt), terminated.FinishedAt, detail)
+		assert.Equal(t, metav1.NewTime(failedAt.Add(-time.Hour)), terminated.StartedAt, detail)
+		assert.Contains(t, terminated.Message, detail)
+	}
+}
+
+func Test_setTerminationStatus(t *testing.T) {
+	now := time.Now()
+	terminations := getPodTerminations([]saladclient.WorkloadError{
+		newTestWorkloadError("a", "Container exited with code 3", now.Add(-time.Minute)),
+		newTestWorkloadError("a", "Container exited with code 2", now.Add(-time.Hour)),
+	}, nil, nil)
+	require.Len(t, terminations, 2)
+
+	// A container failing again and again backs off
+	containerStatus := corev1.ContainerStatus{Name: "web", State: getInstanceContainerState(&saladclient.ContainerGroupInstance{Id: "a", State: saladclient.CONTAINERGROUPINSTANCESTATE_CREATING})}
+	setTerminationStatus(&containerStatus, saladclient.CONTAINERGROUPSTATUS_RUNNING, terminations, now)
+	require.NotNil(t, containerStatus.State.Waiting)
+	assert.Equal(t, crashLoopBackOffReason, containerStatus.State.Waiting.Reason)
+	assert.Equal(t, int32(3), containerStatus.LastTerminationState.Terminated.ExitCode)
+
+	// Until it runs again, or stays down for long
+	containerStatus.State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	setTerminationStatus(&containerStatus, saladclient.CONTAINERGROUPSTATUS_RUNNING, terminations, now)
+	assert.NotNil(t, containerStatus.State.Running)
+	containerStatus.State = getInstanceContainerState(&saladclient.ContainerGroupInstance{Id: "a", State: saladclient.CONTAINERGROUPINSTANCESTATE_CREATING})
+	setTerminationStatus(&containerStatus, saladclient.CONTAINERGROUPSTATUS_RUNNING, terminations, now.Add(crashLoopBackOffWindow))
+	assert.Equal(t, "Creating", containerStatus.State.Waiting.Reason)
+
+	// The last failure terminates the container of a failed container group
+	containerStatus = corev1.ContainerStatus{Name: "web"}
+	setTerminationStatus(&containerStatus, saladclient.CONTAINERGROUPSTATUS_FAILED, terminations, now)
+	assert.Equal(t, int32(3), containerStatus.State.Terminated.ExitCode)
+	assert.Equal(t, int32(2), containerStatus.LastTerminationState.Terminated.ExitCode)
+
+	// Pods sharing the container group of their ReplicaSet only own the failures of their instance
+	owner := &metav1.OwnerReference{Kind: "ReplicaSet", Name: "api", UID: "rs-uid"}
+	assert.Len(t, getPodTerminations(terminations, owner, &saladclient.ContainerGroupInstance{Id: "b"}), 0)
+	assert.Len(t, getPodTerminations(terminations, owner, &saladclient.ContainerGroupInstance{Id: "a"}), 2)
+}
@@ -0,0 +1,267 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/trace"
+	"golang.org/x/time/rate"
+)
+
+// Bounds of the jittered exponential backoff between retries
+var (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// Returned for every call while the SaladCloud API is considered down
+var errCircuitOpen = errors.New("SaladCloud API circuit breaker is open")
+
+// apiTransport is the middleware shared by every SaladCloud API call. It limits the request
+// rate, retries failed calls with backoff and stops calling the API while it is down.
+type apiTransport struct {
+	next       http.RoundTripper
+	limiter    *rate.Limiter
+	maxRetries int
+	breaker    *circuitBreaker
+	logger     log.Logger
+}
+
+func newAPITransport(next http.RoundTripper, inputVars models.InputVars, breaker *circuitBreaker, logger log.Logger) *apiTransport {
+	limit := rate.Inf
+	if inputVars.APIRateLimit > 0 {
+		limit = rate.Limit(inputVars.APIRateLimit)
+	}
+	burst := inputVars.APIRateBurst
+	if burst < 1 {
+		burst = 1
+	}
+	return &apiTransport{
+		next:       next,
+		limiter:    rate.NewLimiter(limit, burst),
+		maxRetries: inputVars.APIMaxRetries,
+		breaker:    breaker,
+		logger:     logger,
+	}
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (response *http.Response, err error) {
+	// One span covers the call with all of its retries
+	ctx, span := trace.StartSpan(req.Context(), "SaladCloudAPI")
+	defer span.End()
+	ctx = span.WithFields(ctx, log.Fields{"method": req.Method, "path": req.URL.Path})
+	req = req.WithContext(ctx)
+	defer func() {
+		if err == nil && response.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(fmt.Errorf("SaladCloud API returned %s", response.Status))
+		} else {
+			span.SetStatus(err)
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		if !t.breaker.allow() {
+			return nil, errCircuitOpen
+		}
+		waitStart := time.Now()
+		if err := t.limiter.Wait(ctx); err != nil {
+			// Nothing was sent, let another call probe the API
+			t.breaker.release()
+			return nil, err
+		}
+		apiRateLimitWaitDuration.Observe(time.Since(waitStart).Seconds())
+		if attempt > 0 && req.Body != nil {
+			// The previous attempt consumed the body
+			body, err := req.GetBody()
+			if err != nil {
+				t.breaker.release()
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		start := time.Now()
+		response, err = t.next.RoundTrip(req)
+		operation := getAPIOperation(req)
+		apiRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		apiRequestsTotal.WithLabelValues(operation, getStatusCodeLabel(response, err)).Inc()
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the API health
+			t.breaker.release()
+			return response, err
+		}
+		if err != nil || response.StatusCode >= http.StatusInternalServerError {
+			t.breaker.failure()
+		} else {
+			t.breaker.success()
+		}
+
+		delay, retry := t.getRetryDelay(req, response, err, attempt)
+		if !retry {
+			return response, err
+		}
+		t.logger.Warnf("SaladCloud API %s %s failed (attempt %d), retrying in %s", req.Method, req.URL.Path, attempt+1, delay)
+		if response != nil {
+			// Free the connection for the next attempt
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// getRetryDelay decides whether a call is retried and how long to wait before the next attempt
+func (t *apiTransport) getRetryDelay(req *http.Request, response *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+		return 0, false
+	}
+	if response != nil && response.StatusCode == http.StatusTooManyRequests {
+		// The request was not processed, so it is safe to send it again whatever the method
+		if delay, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return delay, true
+		}
+		return getBackoffDelay(attempt), true
+	}
+	if !isIdempotent(req.Method) {
+		return 0, false
+	}
+	if err != nil {
+		return getBackoffDelay(attempt), true
+	}
+	switch response.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return getBackoffDelay(attempt), true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// getBackoffDelay returns a random delay up to the exponential backoff of the attempt ("full jitter")
+func getBackoffDelay(attempt int) time.Duration {
+	backoff := retryMaxDelay
+	if attempt < 16 {
+		backoff = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// circuitBreaker opens after a number of consecutive failed calls and lets a single probe call
+// through once the cooldown has passed. A threshold of zero disables it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	// Called with true when the breaker opens and with false when it closes again
+	onChange func(open bool)
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold == 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	wasOpen := b.threshold > 0 && b.failures >= b.threshold
+	b.failures = 0
+	b.probing = false
+	onChange := b.onChange
+	b.mu.Unlock()
+	if wasOpen && onChange != nil {
+		onChange(false)
+	}
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	if b.threshold == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.failures++
+	opened := b.failures == b.threshold
+	if b.failures >= b.threshold {
+		// A failed probe restarts the cooldown
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+	onChange := b.onChange
+	b.mu.Unlock()
+	if opened && onChange != nil {
+		onChange(true)
+	}
+}
+
+// release lets another probe through when the current one was cancelled before it completed
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) setOnChange(onChange func(open bool)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = onChange
+}
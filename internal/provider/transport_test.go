@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaladTechnologies/virtual-kubelet-saladcloud/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newStatusTransport answers with the given status codes in turn and counts the calls
+func newStatusTransport(calls *int, header http.Header, statusCodes ...int) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		statusCode := statusCodes[min(*calls, len(statusCodes)-1)]
+		*calls++
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader("{}")),
+			Request:    req,
+		}, nil
+	})
+}
+
+func Test_apiTransport_retries(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	inputs := models.InputVars{APIMaxRetries: 3}
+	newRequest := func(method string) *http.Request {
+		req, err := http.NewRequest(method, "http://localhost/organizations/org", strings.NewReader("{}"))
+		require.NoError(t, err)
+		return req
+	}
+
+	// Idempotent calls are retried on 5xx
+	calls := 0
+	transport := newAPITransport(newStatusTransport(&calls, nil, 503, 503, 200), inputs, newCircuitBreaker(0, 0), log.G(context.Background()))
+	response, err := transport.RoundTrip(newRequest(http.MethodGet))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 3, calls)
+
+	// Creating a container group is never sent twice after a server error
+	calls = 0
+	transport = newAPITransport(newStatusTransport(&calls, nil, 503, 200), inputs, newCircuitBreaker(0, 0), log.G(context.Background()))
+	response, err = transport.RoundTrip(newRequest(http.MethodPost))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, 1, calls)
+
+	// 429 is retried whatever the method
+	calls = 0
+	transport = newAPITransport(newStatusTransport(&calls, http.Header{"Retry-After": []string{"0"}}, 429, 201), inputs, newCircuitBreaker(0, 0), log.G(context.Background()))
+	response, err = transport.RoundTrip(newRequest(http.MethodPost))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, 2, calls)
+
+	// Retries stop after the configured number of attempts
+	calls = 0
+	transport = newAPITransport(newStatusTransport(&calls, nil, 500), inputs, newCircuitBreaker(0, 0), log.G(context.Background()))
+	response, err = transport.RoundTrip(newRequest(http.MethodDelete))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, 4, calls)
+}
+
+func Test_circuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(2, time.Hour)
+	var changes []bool
+	breaker.setOnChange(func(open bool) { changes = append(changes, open) })
+
+	calls := 0
+	transport := newAPITransport(newStatusTransport(&calls, nil, 500, 500, 200), models.InputVars{}, breaker, log.G(context.Background()))
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		_, _ = transport.RoundTrip(req)
+	}
+	assert.True(t, breaker.isOpen())
+	assert.Equal(t, []bool{true}, changes)
+
+	// No calls reach the API while the breaker is open
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	_, err := transport.RoundTrip(req)
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	// A successful probe after the cooldown closes it
+	breaker.cooldown = 0
+	_, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	assert.False(t, breaker.isOpen())
+	assert.Equal(t, []bool{true, false}, changes)
+}
+
+func Test_circuitBreaker_probeNotSent(t *testing.T) {
+	breaker := newCircuitBreaker(1, 0)
+	calls := 0
+	// A single request every hour
+	inputVars := models.InputVars{APIRateLimit: 1.0 / 3600, APIRateBurst: 1}
+	transport := newAPITransport(newStatusTransport(&calls, nil, 500), inputVars, breaker, log.G(context.Background()))
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	_, _ = transport.RoundTrip(req)
+	require.True(t, breaker.isOpen())
+
+	// The probe gives up waiting for the rate limiter without reaching the API
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transport.RoundTrip(req.WithContext(ctx))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, 1, calls)
+
+	// So the next call may probe the API
+	assert.True(t, breaker.allow())
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	delay, ok := parseRetryAfter("7")
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, delay, float64(2*time.Second))
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func Test_contextWithAuth_cancellation(t *testing.T) {
+	p := newTestServerProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	p.inputVars.APIReadTimeout = time.Hour
+
+	// The caller's deadline reaches the HTTP request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := p.GetPodStatus(ctx, "default", "web")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// And so does the per-operation deadline
+	p.inputVars.APIReadTimeout = 50 * time.Millisecond
+	start = time.Now()
+	_, err = p.GetPodStatus(context.Background(), "default", "web")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -2,9 +2,13 @@
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"strings"
 
 	saladclient "github.com/SaladTechnologies/salad-client"
 	corev1 "k8s.io/api/core/v1"
@@ -20,35 +24,54 @@ func roundUpToNearest(value int64, list []int64) int64 {
 	return list[len(list)-1]
 }
 
-// GetPodResource returns the total CPU in rounded cores and memory rounded to gibibytes (GiB) for the provided PodSpec.
-func GetPodResource(podSpec corev1.PodSpec) (cpu int64, memory int64) {
+// GetContainerResource returns the CPU in rounded cores and memory rounded to gibibytes (GiB) for the provided container.
+func GetContainerResource(container corev1.Container) (cpu int64, memory int64) {
 	allowedCPUValues := []int64{1, 2, 3, 4, 6, 8, 12, 16}
 
 	allowedMemoryValues := []int64{1024, 2048, 3072, 4 * 1024, 6 * 1024, 8 * 1024, 12 * 1024, 16 * 1024, 24 * 1024, 30 * 1024, 38 * 1024, 60 * 1024} // in GiB
 
-	for _, container := range podSpec.Containers {
-		// Convert milliCPU to cores and round to nearest value in the list
-		cpuValue := container.Resources.Requests.Cpu().MilliValue() / 1000
-		cpu += roundUpToNearest(cpuValue, allowedCPUValues)
+	// Convert milliCPU to cores and round to nearest value in the list
+	cpuValue := container.Resources.Requests.Cpu().MilliValue() / 1000
+	cpu = roundUpToNearest(cpuValue, allowedCPUValues)
 
-		// Convert bytes to gibibytes (GiB) and ensure it's a multiple of 1 GiB (1 GiB = 1024*1024 bytes)
-		memValue := container.Resources.Requests.Memory().Value() / (1024 * 1024)
-		memory += roundUpToNearest(memValue, allowedMemoryValues)
-	}
+	// Convert bytes to gibibytes (GiB) and ensure it's a multiple of 1 GiB (1 GiB = 1024*1024 bytes)
+	memValue := container.Resources.Requests.Memory().Value() / (1024 * 1024)
+	memory = roundUpToNearest(memValue, allowedMemoryValues)
 	return
 }
 
-func GetPodName(nameSpace, containerGroup string, pod *corev1.Pod) string {
-	if nameSpace == "" {
-		nameSpace = pod.Namespace
-	}
-	if containerGroup == "" {
-		containerGroup = pod.Name
+// SaladCloud container group names are at most 63 lowercase letters, digits and hyphens,
+// starting with a letter and ending with a letter or digit
+const (
+	maxContainerGroupNameLength  = 63
+	containerGroupNameHashLength = 8
+)
+
+var invalidContainerGroupNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// GetContainerGroupName returns the name of the container group of a pod. The readable
+// namespace-name prefix is truncated to fit and a hash of the namespace and name keeps the name
+// unique, so "a-b"/"c" and "a"/"b-c" do not collide.
+func GetContainerGroupName(namespace, name string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + name))
+	hash := hex.EncodeToString(sum[:])[:containerGroupNameHashLength]
+
+	prefix := invalidContainerGroupNameChars.ReplaceAllString(strings.ToLower(namespace+"-"+name), "-")
+	if prefix == "" || prefix[0] < 'a' || prefix[0] > 'z' {
+		prefix = "pod-" + prefix
 	}
-	if nameSpace == "" && containerGroup == "" && pod.Spec.Containers[0].Name != "" {
-		return pod.Spec.Containers[0].Name
+	maxPrefixLength := maxContainerGroupNameLength - containerGroupNameHashLength - 1
+	if len(prefix) > maxPrefixLength {
+		prefix = prefix[:maxPrefixLength]
 	}
-	return nameSpace + "-" + containerGroup
+	prefix = strings.TrimRight(prefix, "-")
+	return prefix + "-" + hash
+}
+
+// GetLegacyContainerGroupName returns the namespace-name the container group of a pod was named
+// before GetContainerGroupName, which existing container groups keep
+func GetLegacyContainerGroupName(namespace, name string) string {
+	return namespace + "-" + name
 }
 
 func GetPodPhaseFromContainerGroupState(containerGroupState saladclient.ContainerGroupState) corev1.PodPhase {
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerGroupName(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+	name := GetContainerGroupName("default", "web")
+	assert.Regexp(t, valid, name)
+	assert.True(t, strings.HasPrefix(name, "default-web-"))
+	assert.Equal(t, name, GetContainerGroupName("default", "web"))
+
+	// Hyphens in namespaces and names do not collide
+	assert.NotEqual(t, GetContainerGroupName("a-b", "c"), GetContainerGroupName("a", "b-c"))
+
+	// Long names are truncated and stay unique
+	long := strings.Repeat("x", 63)
+	assert.Regexp(t, valid, GetContainerGroupName(long, long+"1"))
+	assert.NotEqual(t, GetContainerGroupName(long, long+"1"), GetContainerGroupName(long, long+"2"))
+
+	// Names always start with a letter
+	assert.Regexp(t, valid, GetContainerGroupName("1-team", "web.v2"))
+}